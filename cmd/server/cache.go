@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/album"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/pkg/cache"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// cacheAlbums wraps the album repository with a cache if one is configured, and keeps removing the albums changed
+// by other server instances from the cache as the broker delivers their events. It returns the repository and
+// a function closing the connection to the cache.
+func cacheAlbums(repo album.Repository, broker *album.Broker, cfg *config.Config, m *metrics.Metrics, logger log.Logger) (album.Repository, func(), error) {
+	var store cache.Store
+	closeCache := func() {}
+	switch cfg.Cache.Store {
+	case "memory":
+		store = cache.NewLRU(cfg.Cache.Size)
+	case "redis":
+		options, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid Redis URL: %v", err)
+		}
+		client := redis.NewClient(options)
+		store = cache.NewRedis(client, "go-rest-api:")
+		closeCache = func() {
+			if err := client.Close(); err != nil {
+				logger.Error(err)
+			}
+		}
+	default:
+		return repo, closeCache, nil
+	}
+
+	cached := album.NewCachedRepository(repo, store, time.Duration(cfg.Cache.TTL)*time.Second, func(hit bool) {
+		m.ObserveCache("album", hit)
+	}, logger)
+	go cached.Watch(context.Background(), broker)
+	return cached, closeCache, nil
+}
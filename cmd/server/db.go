@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/album"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/healthcheck"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/metrics"
+	"github.com/qiangxue/go-rest-api/pkg/pgnotify"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// connectDB connects to the database and its read replicas, and registers their metrics and readiness checks.
+// It returns the database, the channel of the album change notifications, which is nil if the database cannot
+// send notifications, and a function closing the connections.
+func connectDB(cfg *config.Config, logger log.Logger, m *metrics.Metrics, tp trace.TracerProvider, checker *healthcheck.Checker) (*dbcontext.DB, <-chan string, func(), error) {
+	var closers []func() error
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i](); err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+
+	db, err := dbcontext.Open(cfg.DSN, dbOptions(cfg.DB), logger.Warnf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	closers = append(closers, db.Close)
+	// apply the new database migrations, waiting for the other server instances doing the same
+	if *flagMigrateOnStart {
+		migrator, err := newMigrator(db, logger.Named("migrate"))
+		if err == nil {
+			err = migrator.Up(context.Background())
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, nil, fmt.Errorf("failed to migrate the database: %v", err)
+		}
+	}
+	if err := m.RegisterDB(db.DB()); err != nil {
+		closeAll()
+		return nil, nil, nil, err
+	}
+	db.QueryLogFunc = logDBQuery(logger.Named("db"), m, tp)
+	db.ExecLogFunc = logDBExec(logger.Named("db"), m, tp)
+	// check the connections to the database when probing the readiness of the server
+	checker.AddReadinessCheck("db", healthcheck.DBCheck(db.DB()))
+
+	// connect to the read replicas, which serve the read-only queries of API requests
+	var replicas []*dbx.DB
+	for _, dsn := range cfg.ReplicaDSNs {
+		replica, err := dbcontext.Open(dsn, dbOptions(cfg.DB), logger.Warnf)
+		if err != nil {
+			closeAll()
+			return nil, nil, nil, err
+		}
+		closers = append(closers, replica.Close)
+		replica.QueryLogFunc = logDBQuery(logger.Named("db.replica"), m, tp)
+		replica.ExecLogFunc = logDBExec(logger.Named("db.replica"), m, tp)
+		replicas = append(replicas, replica)
+	}
+	dbc := dbcontext.New(db, replicas...)
+	// take the replicas lagging behind out of rotation until they catch up
+	go dbc.MonitorReplicas(context.Background(), time.Duration(cfg.ReplicaCheckInterval)*time.Second,
+		time.Duration(cfg.ReplicaMaxLag)*time.Second, logger.Named("db.replica").Warnf)
+
+	// listen to the album changes announced by all server instances via PostgreSQL notifications.
+	// SQLite has no notifications, so the album change feed only polls the events of the single server instance.
+	if db.DriverName() != "postgres" {
+		return dbc, nil, closeAll, nil
+	}
+	listener, err := pgnotify.Listen(cfg.DSN, album.EventChannel, logger.Named("pgnotify"))
+	if err != nil {
+		closeAll()
+		return nil, nil, nil, err
+	}
+	closers = append(closers, listener.Close)
+	checker.AddReadinessCheck("pgnotify", func(context.Context) error {
+		return listener.Ping()
+	})
+	return dbc, listener.C(), closeAll, nil
+}
+
+// albumStorage returns the repositories keeping the albums and their change events in the given database, and
+// the function running transactions of the database. The albums are kept in memory if the database is nil.
+func albumStorage(db *dbcontext.DB, logger log.Logger) (album.Repository, album.EventRepository, dbcontext.TransactionFunc) {
+	if db == nil {
+		// the changes made to memory cannot be rolled back, so the functions are simply called
+		return album.NewMemoryRepository(), album.NewMemoryEventRepository(),
+			func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	}
+	return album.NewRepository(db, logger), album.NewEventRepository(db, logger), db.Transactional
+}
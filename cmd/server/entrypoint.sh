@@ -2,7 +2,7 @@
 
 exec > >(tee -a /var/log/app/entry.log|logger -t server -s 2>/dev/console) 2>&1
 
-APP_ENV=${APP_ENV:-local}
+export APP_ENV=${APP_ENV:-local}
 
 echo "[`date`] Running entrypoint script in the '${APP_ENV}' environment..."
 
@@ -13,7 +13,7 @@ if [[ -z ${APP_DSN} ]]; then
 fi
 
 echo "[`date`] Running DB migrations..."
-migrate -database "${APP_DSN}" -path ./migrations up
+./server -config ${CONFIG_FILE} migrate up
 
 echo "[`date`] Starting server..."
 ./server -config ${CONFIG_FILE} >> /var/log/app/server.log 2>&1
@@ -10,23 +10,46 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/qiangxue/go-rest-api/internal/admin"
 	"github.com/qiangxue/go-rest-api/internal/album"
 	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/config"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/internal/healthcheck"
+	"github.com/qiangxue/go-rest-api/internal/idempotency"
+	"github.com/qiangxue/go-rest-api/internal/ratelimit"
+	"github.com/qiangxue/go-rest-api/internal/version"
 	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/bodylog"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/i18n"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/metrics"
+	"github.com/qiangxue/go-rest-api/pkg/timeout"
+	"github.com/qiangxue/go-rest-api/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 // Version indicates the current version of the application.
 var Version = "1.0.0"
 
+// Commit and BuildTime indicate the git commit and the time of the build. They can be injected via ldflags;
+// otherwise they are taken from the version control information embedded in the binary, if any.
+var Commit, BuildTime string
+
+// startTime is the time the server started, from which its uptime is measured.
+var startTime = time.Now()
+
 var flagConfig = flag.String("config", "./config/local.yml", "path to the config file")
+var flagMigrateOnStart = flag.Bool("migrate-on-start", false, "apply the new database migrations before starting the server")
 
 func main() {
 	flag.Parse()
@@ -40,29 +63,138 @@ func main() {
 		os.Exit(-1)
 	}
 
-	// connect to the database
-	db, err := dbx.MustOpen("postgres", cfg.DSN)
+	// create the logger as configured, whose levels can be changed via the admin endpoint
+	l, levels, err := log.NewWithOptions(log.Options{
+		Level:          cfg.Log.Level,
+		Encoding:       cfg.Log.Encoding,
+		Outputs:        cfg.Log.Outputs,
+		Packages:       cfg.Log.Packages,
+		RedactFields:   cfg.Log.RedactFields,
+		RedactPatterns: cfg.Log.RedactPatterns,
+	})
 	if err != nil {
-		logger.Error(err)
+		logger.Errorf("failed to create logger: %s", err)
+		os.Exit(-1)
+	}
+	logger = l.With(nil, "version", Version)
+
+	// run the requested command instead of the server, if any
+	if flag.NArg() > 0 {
+		switch command := flag.Arg(0); command {
+		case "migrate":
+			err = runMigrate(flag.Args()[1:], cfg, logger.Named("migrate"))
+		case "seed":
+			err = runSeed(flag.Args()[1:], cfg, logger.Named("seed"))
+		default:
+			err = fmt.Errorf("unknown command: %v", command)
+		}
+		if err != nil {
+			logger.Error(err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if cfg.Debug {
+		logger.Warnf("debug mode is enabled: server error responses will expose internal details")
+	}
+
+	// load the message catalogs used to translate the error messages
+	translator, err := i18n.Load(cfg.LocalesDir)
+	if err != nil {
+		logger.Errorf("failed to load message catalogs: %s", err)
+		os.Exit(-1)
+	}
+
+	// set up the tracing of requests and DB operations
+	tp, err := tracing.New(cfg.TraceExporter, "go-rest-api", Version)
+	if err != nil {
+		logger.Errorf("failed to set up tracing: %s", err)
 		os.Exit(-1)
 	}
-	db.QueryLogFunc = logDBQuery(logger)
-	db.ExecLogFunc = logDBExec(logger)
 	defer func() {
-		if err := db.Close(); err != nil {
+		// flush the pending spans
+		if err := tp.Shutdown(context.Background()); err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	// collect the HTTP, DB and runtime metrics
+	build := buildinfo.Read(Version, Commit, BuildTime)
+	m := metrics.New()
+	if err := m.RegisterBuildInfo(build); err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+
+	// probe the readiness of the server and its dependencies
+	checker := healthcheck.NewChecker(time.Duration(cfg.HealthcheckTimeout) * time.Second)
+
+	// connect to the database unless the data is kept in memory
+	var dbc *dbcontext.DB
+	var notifications <-chan string
+	if cfg.Storage != "memory" {
+		var closeDB func()
+		if dbc, notifications, closeDB, err = connectDB(cfg, logger, m, tp, checker); err != nil {
 			logger.Error(err)
+			os.Exit(-1)
+		}
+		defer closeDB()
+	}
+
+	// start delivering album changes to the album change feed
+	albumLogger := logger.Named("album")
+	albums, events, transactional := albumStorage(dbc, albumLogger)
+	broker := album.NewBroker(events, time.Duration(cfg.StreamHeartbeat)*time.Second, albumLogger)
+	go func() {
+		if err := broker.Run(context.Background(), notifications); err != nil {
+			logger.Errorf("album change feed stopped: %v", err)
 		}
 	}()
+	// cache the album reads if configured
+	albums, closeCache, err := cacheAlbums(albums, broker, cfg, m, albumLogger)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	defer closeCache()
+	albumService := album.NewService(albums, events, transactional, albumLogger)
 
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(logger, dbc, albumService, broker, translator, m, tp, checker, cfg),
+	}
+	// close the open album change streams so that they don't block the graceful shutdown
+	hs.RegisterOnShutdown(broker.Close)
+
+	// start the admin server exposing the metrics and the build and runtime information on a separate port
+	// so that they are not public
+	if cfg.AdminPort != 0 {
+		versionLogger := logger.Named("version")
+		var versionRepository version.Repository
+		if dbc != nil {
+			versionRepository = version.NewRepository(dbc, versionLogger)
+		}
+		versionService := version.NewService(build, cfg, versionRepository, startTime, versionLogger)
+
+		adminAddress := fmt.Sprintf(":%v", cfg.AdminPort)
+		as := &http.Server{
+			Addr:    adminAddress,
+			Handler: buildAdminHandler(logger, m, levels, versionService, cfg),
+		}
+		go routing.GracefulShutdown(as, 10*time.Second, logger.Infof)
+		go func() {
+			logger.Infof("admin server is running at %v", adminAddress)
+			if err := as.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error(err)
+			}
+		}()
 	}
 
 	// start the HTTP server with graceful shutdown
-	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
+	go gracefulShutdown(hs, checker, time.Duration(cfg.ShutdownDrain)*time.Second, 10*time.Second, logger)
 	logger.Infof("server %v is running at %v", Version, address)
 	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Error(err)
@@ -70,54 +202,212 @@ func main() {
 	}
 }
 
-// buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+// gracefulShutdown shuts down the given HTTP server gracefully when receiving an os.Interrupt or syscall.SIGTERM signal.
+// The server is reported as not ready and keeps serving requests during the drain period, so that load balancers
+// stop sending it new requests before it stops accepting them. It then waits for the timeout to complete
+// the ongoing requests.
+func gracefulShutdown(hs *http.Server, checker *healthcheck.Checker, drain, timeout time.Duration, logger log.Logger) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	checker.Shutdown()
+	if drain > 0 {
+		logger.Infof("draining server for %s", drain)
+		time.Sleep(drain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	logger.Infof("shutting down server with %s timeout", timeout)
+	if err := hs.Shutdown(ctx); err != nil {
+		logger.Errorf("error while shutting down server: %v", err)
+	} else {
+		logger.Infof("server was shut down gracefully")
+	}
+}
+
+// buildHandler sets up the HTTP routing and builds an HTTP handler. The database is nil if the data is kept in memory.
+func buildHandler(logger log.Logger, db *dbcontext.DB, albumService album.Service, broker *album.Broker, translator *i18n.Translator, m *metrics.Metrics, tp trace.TracerProvider, checker *healthcheck.Checker, cfg *config.Config) http.Handler {
 	router := routing.New()
 
+	idempotencyStore := idempotency.NewMemoryStore()
+	if cfg.IdempotencyStore == "postgres" {
+		idempotencyStore = idempotency.NewDBStore(db)
+	}
+
+	rateLimitStore := ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		rateLimitStore = ratelimit.NewDBStore(db)
+	}
+	rateLimitRoutes := map[string]ratelimit.Limit{}
+	for pattern, limit := range cfg.RateLimitRoutes {
+		rateLimitRoutes[pattern] = rateLimit(limit)
+	}
+
+	// the album change feed is a long-lived request which should not time out by default
+	timeoutRoutes := map[string]time.Duration{"GET /v1/albums/stream": 0}
+	for pattern, seconds := range cfg.RequestTimeoutRoutes {
+		timeoutRoutes[pattern] = time.Duration(seconds) * time.Second
+	}
+
 	router.Use(
-		accesslog.Handler(logger),
-		errors.Handler(logger),
+		tracing.Handler(tp),
+		accesslog.Handler(logger, accesslog.Options{
+			Format:         cfg.AccessLog.Format,
+			TrustedProxies: cfg.AccessLog.TrustedProxies,
+			SampleRate:     cfg.AccessLog.SampleRate,
+			Exclude:        cfg.AccessLog.Exclude,
+			SlowThreshold:  time.Duration(cfg.AccessLog.SlowThreshold) * time.Millisecond,
+			UserID:         userID,
+		}),
+		bodylog.Handler(bodyCapture(cfg)),
+		m.Handler(),
+		translator.Handler(),
+		errors.Handler(logger, errors.Options{
+			Legacy:      cfg.ErrorFormat == "legacy",
+			TypeBaseURI: cfg.ErrorTypeBaseURI,
+			Debug:       cfg.Debug && !cfg.IsProd(),
+			Translator:  translator,
+		}),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
 	)
 
-	healthcheck.RegisterHandlers(router, Version)
+	// the probes are registered before the rate limiting, idempotency and timeout handlers,
+	// so that they are answered however busy the server is
+	healthcheck.RegisterHandlers(router, Version, checker)
+
+	router.Use(
+		auth.IdentityHandler(cfg.JWTSigningKey),
+		ratelimit.Handler(rateLimitStore, rateLimit(cfg.RateLimit), rateLimitRoutes, cfg.AccessLog.TrustedProxies, logger),
+		idempotency.Handler(idempotencyStore, time.Duration(cfg.IdempotencyTTL)*time.Hour,
+			time.Duration(cfg.IdempotencyLockTimeout)*time.Second, logger),
+		timeout.Handler(time.Duration(cfg.RequestTimeout)*time.Second, timeoutRoutes),
+	)
+
+	if db != nil {
+		router.Use(db.ReplicaHandler())
+	}
 
 	rg := router.Group("/v1")
 
 	authHandler := auth.Handler(cfg.JWTSigningKey)
 
-	album.RegisterHandlers(rg.Group(""),
-		album.NewService(album.NewRepository(db, logger), logger),
-		authHandler, logger,
-	)
+	albumLogger := logger.Named("album")
+	album.RegisterHandlers(rg.Group(""), albumService, broker, authHandler, albumLogger)
 
+	authLogger := logger.Named("auth")
 	auth.RegisterHandlers(rg.Group(""),
-		auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, logger),
-		logger,
+		auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, authLogger),
+		authLogger,
+	)
+
+	return router
+}
+
+// buildAdminHandler builds the HTTP handler of the admin server.
+func buildAdminHandler(logger log.Logger, m *metrics.Metrics, levels *log.Levels, versionService version.Service, cfg *config.Config) http.Handler {
+	router := routing.New()
+
+	router.Use(
+		errors.Handler(logger, errors.Options{}),
+		content.TypeNegotiator(content.JSON),
 	)
 
+	router.Get("/metrics", routing.HTTPHandler(m))
+	version.RegisterHandlers(router, versionService)
+
+	if cfg.AdminToken != "" {
+		admin.RegisterHandlers(router.Group(""), levels, auth.TokenHandler(cfg.AdminToken), logger.Named("admin"))
+	}
+
 	return router
 }
 
-// logDBQuery returns a logging function that can be used to log SQL queries.
-func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
+// logDBQuery returns a logging function that can be used to log SQL queries and record their durations and spans.
+// The parameter values in the SQL statements are masked.
+func logDBQuery(logger log.Logger, m *metrics.Metrics, tp trace.TracerProvider) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
+		m.ObserveDBQuery(t, err)
+		// mask the parameter values inlined by ozzo-dbx so that they are not logged
+		masked := log.MaskSQL(sql)
+		tracing.RecordDB(ctx, tp, t, masked, err)
 		if err == nil {
-			logger.With(ctx, "duration", t.Milliseconds(), "sql", sql).Info("DB query successful")
+			logger.With(ctx, "duration", t.Milliseconds(), "sql", masked).Info("DB query successful")
 		} else {
-			logger.With(ctx, "sql", sql).Errorf("DB query error: %v", err)
+			logger.With(ctx, "sql", masked).Errorf("DB query error: %v", err)
+			errors.RecordSQL(ctx, sql)
 		}
 	}
 }
 
-// logDBExec returns a logging function that can be used to log SQL executions.
-func logDBExec(logger log.Logger) dbx.ExecLogFunc {
+// logDBExec returns a logging function that can be used to log SQL executions and record their durations and spans.
+// The parameter values in the SQL statements are masked.
+func logDBExec(logger log.Logger, m *metrics.Metrics, tp trace.TracerProvider) dbx.ExecLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, result sql.Result, err error) {
+		m.ObserveDBExec(t, err)
+		// mask the parameter values inlined by ozzo-dbx so that they are not logged
+		masked := log.MaskSQL(sql)
+		tracing.RecordDB(ctx, tp, t, masked, err)
 		if err == nil {
-			logger.With(ctx, "duration", t.Milliseconds(), "sql", sql).Info("DB execution successful")
+			logger.With(ctx, "duration", t.Milliseconds(), "sql", masked).Info("DB execution successful")
 		} else {
-			logger.With(ctx, "sql", sql).Errorf("DB execution error: %v", err)
+			logger.With(ctx, "sql", masked).Errorf("DB execution error: %v", err)
+			errors.RecordSQL(ctx, sql)
 		}
 	}
 }
+
+// bodyCapture converts the body capture configuration into the options of bodylog.Handler.
+// The requests carrying the admin token in the X-Debug-Capture header are captured as well.
+func bodyCapture(cfg *config.Config) bodylog.Options {
+	// the redaction rules have been validated together with the configuration
+	redactor, _ := log.NewRedactor(cfg.Log.RedactFields, cfg.Log.RedactPatterns)
+	options := bodylog.Options{
+		Routes:   cfg.BodyCapture.Routes,
+		Token:    cfg.AdminToken,
+		MaxSize:  cfg.BodyCapture.MaxSize,
+		Redactor: redactor,
+	}
+	if cfg.BodyCapture.File != "" {
+		// the file is rotated once it reaches the maximum size
+		options.Output = &lumberjack.Logger{
+			Filename:   cfg.BodyCapture.File,
+			MaxSize:    cfg.BodyCapture.FileMaxSize,
+			MaxBackups: cfg.BodyCapture.FileMaxBackups,
+		}
+	}
+	return options
+}
+
+// dbOptions converts the database configuration into dbcontext.Options.
+func dbOptions(c config.DB) dbcontext.Options {
+	return dbcontext.Options{
+		Driver:           c.Driver,
+		MaxOpenConns:     c.MaxOpenConns,
+		MaxIdleConns:     c.MaxIdleConns,
+		ConnMaxLifetime:  time.Duration(c.ConnMaxLifetime) * time.Second,
+		ConnMaxIdleTime:  time.Duration(c.ConnMaxIdleTime) * time.Second,
+		ConnectTimeout:   time.Duration(c.ConnectTimeout) * time.Second,
+		StatementTimeout: time.Duration(c.StatementTimeout) * time.Millisecond,
+		LockTimeout:      time.Duration(c.LockTimeout) * time.Millisecond,
+	}
+}
+
+// userID returns the ID of the authenticated user in the given context, if any.
+func userID(ctx context.Context) string {
+	if user := auth.CurrentUser(ctx); user != nil {
+		return user.GetID()
+	}
+	return ""
+}
+
+// rateLimit converts a rate limit configuration into a ratelimit.Limit.
+func rateLimit(l config.RateLimit) ratelimit.Limit {
+	period := l.Period
+	if period == 0 {
+		period = 60
+	}
+	return ratelimit.Limit{Requests: l.Requests, Period: time.Duration(period) * time.Second, Burst: l.Burst}
+}
@@ -3,18 +3,34 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/album"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/healthcheck"
+	"github.com/qiangxue/go-rest-api/internal/ratelimit"
+	"github.com/qiangxue/go-rest-api/internal/version"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
+	"github.com/qiangxue/go-rest-api/pkg/fixture"
+	"github.com/qiangxue/go-rest-api/pkg/i18n"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/metrics"
+	"github.com/qiangxue/go-rest-api/pkg/tracing"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
 func Test_logDBQuery(t *testing.T) {
 	logger, entries := log.NewForTest()
-	f := logDBQuery(logger)
-	f(context.Background(), time.Millisecond*3, "sql", nil, nil)
+	tp, spans := tracing.NewForTest()
+	f := logDBQuery(logger, metrics.New(), tp)
+	f(context.Background(), time.Millisecond*3, "SELECT * FROM album WHERE id='123'", nil, nil)
 	if assert.Equal(t, 1, entries.Len()) {
 		assert.Equal(t, "DB query successful", entries.All()[0].Message)
+		assert.Equal(t, "SELECT * FROM album WHERE id=?", entries.All()[0].ContextMap()["sql"])
 	}
 	entries.TakeAll()
 
@@ -22,14 +38,17 @@ func Test_logDBQuery(t *testing.T) {
 	if assert.Equal(t, 1, entries.Len()) {
 		assert.Equal(t, "DB query error: test", entries.All()[0].Message)
 	}
+	assert.Len(t, spans.GetSpans(), 2)
 }
 
 func Test_logDBExec(t *testing.T) {
 	logger, entries := log.NewForTest()
-	f := logDBExec(logger)
-	f(context.Background(), time.Millisecond*3, "sql", nil, nil)
+	tp, spans := tracing.NewForTest()
+	f := logDBExec(logger, metrics.New(), tp)
+	f(context.Background(), time.Millisecond*3, "DELETE FROM album WHERE id='123'", nil, nil)
 	if assert.Equal(t, 1, entries.Len()) {
 		assert.Equal(t, "DB execution successful", entries.All()[0].Message)
+		assert.Equal(t, "DELETE FROM album WHERE id=?", entries.All()[0].ContextMap()["sql"])
 	}
 	entries.TakeAll()
 
@@ -37,4 +56,147 @@ func Test_logDBExec(t *testing.T) {
 	if assert.Equal(t, 1, entries.Len()) {
 		assert.Equal(t, "DB execution error: test", entries.All()[0].Message)
 	}
+	assert.Len(t, spans.GetSpans(), 2)
+}
+
+func Test_rateLimit(t *testing.T) {
+	assert.Equal(t, ratelimit.Limit{Requests: 10, Period: time.Minute}, rateLimit(config.RateLimit{Requests: 10}))
+	assert.Equal(t, ratelimit.Limit{Requests: 10, Period: time.Second, Burst: 5}, rateLimit(config.RateLimit{Requests: 10, Period: 1, Burst: 5}))
+}
+
+func Test_buildHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	tp, _ := tracing.NewForTest()
+	albums, events := album.NewMemoryRepository(), album.NewMemoryEventRepository()
+	broker := album.NewBroker(events, time.Second, logger)
+	defer broker.Close()
+	service := album.NewService(albums, events, nil, logger)
+	cfg := &config.Config{
+		RateLimit:        config.RateLimit{Requests: 1},
+		RateLimitStore:   "memory",
+		IdempotencyStore: "memory",
+		RequestTimeout:   10,
+	}
+	h := buildHandler(logger, nil, service, broker, i18n.New(nil), metrics.New(), tp, healthcheck.NewChecker(time.Second), cfg)
+
+	// the probes succeed once the client has used up its requests
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/albums", nil)
+		h.ServeHTTP(res, req)
+		assert.Equal(t, want, res.Code, i)
+	}
+	for _, url := range []string{"/livez", "/readyz", "/healthcheck"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code, url)
+	}
+}
+
+func Test_buildAdminHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	_, levels, _ := log.NewWithOptions(log.Options{})
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		url        string
+		header     string
+		wantStatus int
+	}{
+		{"metrics", "", "GET", "/metrics", "", http.StatusOK},
+		{"version", "", "GET", "/version", "", http.StatusOK},
+		{"log level disabled", "", "GET", "/admin/log-level", "Bearer ", http.StatusNotFound},
+		{"log level", "secret", "GET", "/admin/log-level", "Bearer secret", http.StatusOK},
+		{"log level unauthorized", "secret", "GET", "/admin/log-level", "Bearer abc", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{AdminToken: tt.token}
+			h := buildAdminHandler(logger, metrics.New(), levels, version.NewService(buildinfo.Info{}, cfg, nil, time.Now(), logger), cfg)
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			req.Header.Set("Authorization", tt.header)
+			h.ServeHTTP(res, req)
+			assert.Equal(t, tt.wantStatus, res.Code)
+		})
+	}
+}
+
+func Test_dbOptions(t *testing.T) {
+	options := dbOptions(config.DB{Driver: "sqlite3", MaxOpenConns: 25, ConnMaxLifetime: 60, StatementTimeout: 1500})
+	assert.Equal(t, "sqlite3", options.Driver)
+	assert.Equal(t, 25, options.MaxOpenConns)
+	assert.Equal(t, time.Minute, options.ConnMaxLifetime)
+	assert.Equal(t, 1500*time.Millisecond, options.StatementTimeout)
+}
+
+func Test_runMigrate(t *testing.T) {
+	logger, _ := log.NewForTest()
+	err := runMigrate(nil, &config.Config{}, logger)
+	assert.EqualError(t, err, migrateUsage)
+
+	// the files of a new migration are created for all databases with the same version
+	dir := t.TempDir()
+	defer func(dirs []string) { migrationsDirs = dirs }(migrationsDirs)
+	migrationsDirs = []string{dir, filepath.Join(dir, "sqlite3")}
+	assert.Nil(t, os.Mkdir(migrationsDirs[1], 0755))
+	assert.Nil(t, runMigrate([]string{"new", "add", "genre"}, &config.Config{}, logger))
+	for _, d := range migrationsDirs {
+		files, _ := filepath.Glob(filepath.Join(d, "*_add_genre.*.sql"))
+		assert.Len(t, files, 2, d)
+	}
+	files1, _ := os.ReadDir(migrationsDirs[0])
+	files2, _ := os.ReadDir(migrationsDirs[1])
+	assert.Equal(t, files1[0].Name(), files2[0].Name())
+}
+
+func Test_fixtures(t *testing.T) {
+	tables, err := fixture.Load(os.DirFS("../../testdata/fixtures"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tables)
+}
+
+func Test_albumStorage(t *testing.T) {
+	logger, _ := log.NewForTest()
+	albums, events, transactional := albumStorage(nil, logger)
+	assert.Equal(t, album.NewMemoryRepository(), albums)
+	assert.Equal(t, album.NewMemoryEventRepository(), events)
+	called := false
+	assert.Nil(t, transactional(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	}))
+	assert.True(t, called)
+}
+
+func Test_cacheAlbums(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := album.NewMemoryRepository()
+	broker := album.NewBroker(album.NewMemoryEventRepository(), time.Second, logger)
+	defer broker.Close()
+	cfg := &config.Config{Cache: config.Cache{Store: "off", TTL: 60, Size: 100}}
+
+	albums, closeCache, err := cacheAlbums(repo, broker, cfg, metrics.New(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, repo, albums)
+	closeCache()
+
+	cfg.Cache.Store = "memory"
+	albums, closeCache, err = cacheAlbums(repo, broker, cfg, metrics.New(), logger)
+	assert.Nil(t, err)
+	assert.IsType(t, &album.CachedRepository{}, albums)
+	closeCache()
+
+	cfg.Cache.Store, cfg.RedisURL = "redis", "redis://localhost:6379/0"
+	albums, closeCache, err = cacheAlbums(repo, broker, cfg, metrics.New(), logger)
+	assert.Nil(t, err)
+	assert.IsType(t, &album.CachedRepository{}, albums)
+	closeCache()
+
+	cfg.RedisURL = "http://localhost"
+	_, _, err = cacheAlbums(repo, broker, cfg, metrics.New(), logger)
+	assert.NotNil(t, err)
 }
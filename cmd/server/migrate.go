@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/migrations"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/migrate"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsDirs are the directories where the "migrate new" command creates the migration files:
+// those of PostgreSQL and those of SQLite, which must have the same versions.
+var migrationsDirs = []string{"./migrations", "./migrations/sqlite3"}
+
+// migrateUsage describes the arguments of the migrate command.
+const migrateUsage = `usage: server [-config file] migrate <command>
+
+commands:
+  up             apply all new migrations
+  down [N]       revert the last N migrations (default 1)
+  goto V         apply or revert the migrations up to the version V (0 reverts all migrations)
+  version        show the version of the latest migration applied
+  force V        record V as the version of the latest migration applied without running any migration
+  new NAME       create the files of a new migration for PostgreSQL and SQLite`
+
+// runMigrate runs the migrate command with the given arguments, which migrates the database with the migrations
+// embedded in the binary.
+func runMigrate(args []string, cfg *config.Config, logger log.Logger) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command, args := args[0], args[1:]
+	if command == "new" {
+		now := time.Now()
+		for _, dir := range migrationsDirs {
+			files, err := migrate.Create(dir, strings.Join(args, "_"), now)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				logger.Infof("created %v", file)
+			}
+		}
+		return nil
+	}
+
+	db, err := dbcontext.Open(cfg.DSN, dbOptions(cfg.DB), logger.Warnf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := newMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations: %v", args[0])
+			}
+		}
+		return m.Down(ctx, steps)
+	case "goto", "force":
+		if len(args) == 0 {
+			return fmt.Errorf("the migration version is required")
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version: %v", args[0])
+		}
+		if command == "force" {
+			return m.Force(ctx, version)
+		}
+		return m.Goto(ctx, version)
+	case "version":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			logger.Infof("version %v (dirty)", version)
+		} else {
+			logger.Infof("version %v", version)
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+// newMigrator creates a migrator of the given database using the migrations embedded for its driver.
+func newMigrator(db *dbx.DB, logger log.Logger) (*migrate.Migrator, error) {
+	fsys, err := migrations.For(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db.DB(), db.DriverName(), fsys, logger.Infof)
+}
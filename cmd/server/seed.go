@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/fixture"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"os"
+)
+
+// fixturesDir is the default directory of the fixtures loaded by the seed command.
+const fixturesDir = "./testdata/fixtures"
+
+// runSeed runs the seed command, which replaces all data in the tables having fixtures with those fixtures.
+// The arguments are the directory of the fixtures, followed by the tables to seed (all tables if none is given).
+func runSeed(args []string, cfg *config.Config, logger log.Logger) error {
+	dir := fixturesDir
+	if len(args) > 0 {
+		dir, args = args[0], args[1:]
+	}
+	tables, err := fixture.Load(os.DirFS(dir), args...)
+	if err != nil {
+		return err
+	}
+
+	db, err := dbcontext.Open(cfg.DSN, dbOptions(cfg.DB), logger.Warnf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dbc := dbcontext.New(db)
+	err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+		return fixture.Insert(ctx, dbc.With(ctx), tables)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed the database: %v", err)
+	}
+	for _, table := range tables {
+		logger.Infof("seeded %v rows into %v", len(table.Rows), table.Name)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package admin provides the endpoints for administering a running server.
+package admin
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// RegisterHandlers sets up the routing of the admin endpoints, which are protected by the given authentication middleware.
+func RegisterHandlers(r *routing.RouteGroup, levels *log.Levels, authHandler routing.Handler, logger log.Logger) {
+	res := resource{levels, logger}
+
+	r.Use(authHandler)
+
+	r.Get("/admin/log-level", res.getLogLevel)
+	r.Put("/admin/log-level", res.updateLogLevel)
+}
+
+// LogLevels represents the log levels of the server.
+type LogLevels struct {
+	// Level is the minimum level of the log messages.
+	Level string `json:"level"`
+	// Packages lists the minimum levels of the packages that override Level.
+	Packages map[string]string `json:"packages"`
+}
+
+// UpdateLogLevelRequest represents a request to change a log level.
+type UpdateLogLevelRequest struct {
+	// Package is the name of the package whose level is changed. The level of the server is changed if empty.
+	Package string `json:"package"`
+	// Level is the new level. An empty level removes the level of the package.
+	Level string `json:"level"`
+}
+
+// Validate validates the UpdateLogLevelRequest fields.
+func (m UpdateLogLevelRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Level,
+			validation.When(m.Package == "", validation.Required),
+			validation.In("debug", "info", "warn", "error"),
+		),
+	)
+}
+
+type resource struct {
+	levels *log.Levels
+	logger log.Logger
+}
+
+func (r resource) getLogLevel(c *routing.Context) error {
+	return c.Write(r.logLevels())
+}
+
+func (r resource) updateLogLevel(c *routing.Context) error {
+	var input UpdateLogLevelRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	if input.Level == "" {
+		r.levels.Reset(input.Package)
+	} else if err := r.levels.Set(input.Package, input.Level); err != nil {
+		return err
+	}
+	r.logger.With(c.Request.Context(), "package", input.Package).Infof("log level changed to %q", input.Level)
+
+	return c.Write(r.logLevels())
+}
+
+// logLevels returns the current log levels.
+func (r resource) logLevels() LogLevels {
+	return LogLevels{Level: r.levels.Level(), Packages: r.levels.Packages()}
+}
@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	_, levels, err := log.NewWithOptions(log.Options{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	router := test.MockRouter(logger)
+	RegisterHandlers(router.Group(""), levels, auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get", "GET", "/admin/log-level", "", header, http.StatusOK, `{"level":"info","packages":{}}`},
+		{"get auth error", "GET", "/admin/log-level", "", nil, http.StatusUnauthorized, ""},
+		{"update", "PUT", "/admin/log-level", `{"level":"warn"}`, header, http.StatusOK, `{"level":"warn","packages":{}}`},
+		{"update package", "PUT", "/admin/log-level", `{"package":"album","level":"debug"}`, header, http.StatusOK, `{"level":"warn","packages":{"album":"debug"}}`},
+		{"reset package", "PUT", "/admin/log-level", `{"package":"album"}`, header, http.StatusOK, `{"level":"warn","packages":{}}`},
+		{"update auth error", "PUT", "/admin/log-level", `{"level":"debug"}`, nil, http.StatusUnauthorized, ""},
+		{"update input error", "PUT", "/admin/log-level", `"level":"debug"}`, header, http.StatusBadRequest, ""},
+		{"update invalid level", "PUT", "/admin/log-level", `{"level":"verbose"}`, header, http.StatusBadRequest, `*"field":"level"*`},
+		{"update missing level", "PUT", "/admin/log-level", `{}`, header, http.StatusBadRequest, `*"field":"level"*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+	assert.Equal(t, "warn", levels.Level())
+}
@@ -1,17 +1,25 @@
 package album
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/qiangxue/go-rest-api/pkg/pagination"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
-func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
-	res := resource{service, logger}
+func RegisterHandlers(r *routing.RouteGroup, service Service, broker *Broker, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, broker, logger}
 
+	r.Get("/albums/stream", res.stream)
 	r.Get("/albums/<id>", res.get)
 	r.Get("/albums", res.query)
 
@@ -25,6 +33,7 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 
 type resource struct {
 	service Service
+	broker  *Broker
 	logger  log.Logger
 }
 
@@ -89,3 +98,111 @@ func (r resource) delete(c *routing.Context) error {
 
 	return c.Write(album)
 }
+
+// stream sends the album changes to the client as Server-Sent Events.
+//
+// A client may resume the stream by passing the ID of the last event it received via the "Last-Event-ID" header
+// or the "last_event_id" query parameter. Otherwise, only the changes made after the connection is established
+// are sent. The events may be filtered by album IDs (comma-separated "id" query parameter) and by the ID of the
+// user who made the changes ("owner" query parameter).
+func (r resource) stream(c *routing.Context) error {
+	ctx := c.Request.Context()
+	since, err := parseLastEventID(c)
+	if err != nil {
+		return errors.BadRequest("The last event ID must be a non-negative integer.").
+			WithMessageKey("INVALID_LAST_EVENT_ID", nil)
+	}
+	filter := EventFilter{UserID: c.Query("owner")}
+	if ids := c.Query("id"); ids != "" {
+		filter.AlbumIDs = strings.Split(ids, ",")
+	}
+
+	// subscribe before replaying so that no event is missed in between
+	sub := r.broker.Subscribe(filter)
+	defer r.broker.Unsubscribe(sub)
+	if since < 0 {
+		since = r.broker.Last()
+	}
+
+	header := c.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Response.WriteHeader(http.StatusOK)
+	w := eventWriter{c.Response}
+
+	last, err := r.broker.Replay(ctx, since, filter, w.write)
+	if err != nil {
+		r.logger.With(ctx).Errorf("failed to replay album events: %v", err)
+		return nil
+	}
+	w.flush()
+
+	heartbeat := time.NewTicker(r.broker.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if err := w.comment("heartbeat"); err != nil {
+				return nil
+			}
+		case event, ok := <-sub.C():
+			if !ok {
+				return nil
+			}
+			if event.Seq <= last {
+				continue
+			}
+			last = event.Seq
+			if err := w.write(event); err != nil {
+				return nil
+			}
+		}
+		w.flush()
+	}
+}
+
+// parseLastEventID returns the ID of the last event received by the client, or -1 if the client didn't specify it.
+func parseLastEventID(c *routing.Context) (int64, error) {
+	id := c.Request.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = c.Query("last_event_id")
+	}
+	if id == "" {
+		return -1, nil
+	}
+	seq, err := strconv.ParseInt(id, 10, 64)
+	if err == nil && seq < 0 {
+		err = fmt.Errorf("negative event ID: %v", seq)
+	}
+	return seq, err
+}
+
+// eventWriter writes album events in the Server-Sent Events format.
+type eventWriter struct {
+	w http.ResponseWriter
+}
+
+// write writes an album event.
+func (w eventWriter) write(event entity.AlbumEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+	return err
+}
+
+// comment writes a comment line which is ignored by clients but keeps the connection alive.
+func (w eventWriter) comment(text string) error {
+	_, err := fmt.Fprintf(w.w, ": %s\n\n", text)
+	return err
+}
+
+// flush sends the buffered data to the client, looking through the middlewares wrapping the response writer.
+func (w eventWriter) flush() {
+	accesslog.Flush(w.w)
+}
@@ -1,11 +1,15 @@
 package album
 
 import (
+	"context"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
 	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -16,13 +20,14 @@ func TestAPI(t *testing.T) {
 	repo := &mockRepository{items: []entity.Album{
 		{"123", "album123", time.Now(), time.Now()},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	events := &mockEventRepository{}
+	RegisterHandlers(router.Group(""), NewService(repo, events, mockTransactional, logger), NewBroker(events, time.Second, logger), auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
 
 	tests := []test.APITestCase{
 		{"get all", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":1*`},
 		{"get 123", "GET", "/albums/123", "", nil, http.StatusOK, `*album123*`},
-		{"get unknown", "GET", "/albums/1234", "", nil, http.StatusNotFound, ""},
+		{"get unknown", "GET", "/albums/1234", "", nil, http.StatusNotFound, `*"code":"ALBUM_NOT_FOUND"*`},
 		{"create ok", "POST", "/albums", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
 		{"create ok count", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":2*`},
 		{"create auth error", "POST", "/albums", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
@@ -39,3 +44,46 @@ func TestAPI(t *testing.T) {
 		test.Endpoint(t, router, tc)
 	}
 }
+
+func TestAPI_stream(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	events := &mockEventRepository{}
+	ctx := context.Background()
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "123", UserID: "100"})
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumUpdated, AlbumID: "456", UserID: "200"})
+	broker := NewBroker(events, time.Second, logger)
+	// close the broker so that each stream ends after replaying the stored events
+	broker.Close()
+	RegisterHandlers(router.Group(""), NewService(&mockRepository{}, events, mockTransactional, logger), broker, auth.MockAuthHandler, logger)
+	header := http.Header{}
+	header.Set("Last-Event-ID", "1")
+
+	tests := []test.APITestCase{
+		{Name: "replay", Method: "GET", URL: "/albums/stream?last_event_id=0", WantStatus: http.StatusOK, WantResponse: "*id: 1\nevent: created\n*"},
+		{Name: "resume", Method: "GET", URL: "/albums/stream", Header: header, WantStatus: http.StatusOK, WantResponse: "*id: 2\nevent: updated\n*"},
+		{Name: "filter by id", Method: "GET", URL: "/albums/stream?last_event_id=0&id=456", WantStatus: http.StatusOK, WantResponse: `*"album_id":"456"*`},
+		{Name: "filter by owner", Method: "GET", URL: "/albums/stream?last_event_id=0&owner=100", WantStatus: http.StatusOK, WantResponse: `*"user_id":"100"*`},
+		{Name: "invalid last event ID", Method: "GET", URL: "/albums/stream?last_event_id=abc", WantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+// wrappingWriter is a response writer of a middleware that wraps another one without flushing.
+type wrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func Test_eventWriter_flush(t *testing.T) {
+	res := httptest.NewRecorder()
+	w := eventWriter{wrappingWriter{&access.LogResponseWriter{ResponseWriter: wrappingWriter{res}}}}
+	assert.Nil(t, w.comment("heartbeat"))
+	w.flush()
+	assert.True(t, res.Flushed)
+}
@@ -0,0 +1,204 @@
+package album
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/cache"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"time"
+)
+
+// cacheKeyPrefix is the prefix of the cache keys of albums.
+const cacheKeyPrefix = "album:"
+
+// CachedRepository is a Repository that caches the albums read by Get, so that reading the same album repeatedly
+// does not hit the storage. The other reads are not cached.
+//
+// An album is removed from the cache once a change made to it via the repository is committed. The changes made
+// by other server instances are learned from the album events (see Watch), so until then an instance may serve
+// a stale album for at most the TTL of the cache. With a store shared by the instances, an instance that read
+// an album before another instance changed it may also cache the stale album after the other instance removed it,
+// and the stale album is served until the event of the change reaches the instance or the TTL of the cache elapses.
+type CachedRepository struct {
+	Repository
+	store   cache.Store
+	ttl     time.Duration
+	observe func(hit bool)
+	logger  log.Logger
+
+	group singleflight.Group
+	// mu guards generation. It is held for reading while an album read is cached, and for writing while
+	// albums are invalidated, so that an invalidation cannot happen between checking generation and caching.
+	mu sync.RWMutex
+	// generation is incremented by each invalidation, so that albums read before it are not cached after it.
+	generation uint64
+}
+
+// NewCachedRepository creates a new album repository that caches the albums read from the given repository
+// in the given store for the given period of time. The given function, if not nil, is called with whether
+// each lookup of the cache was a hit.
+func NewCachedRepository(repo Repository, store cache.Store, ttl time.Duration, observe func(hit bool), logger log.Logger) *CachedRepository {
+	if observe == nil {
+		observe = func(bool) {}
+	}
+	return &CachedRepository{Repository: repo, store: store, ttl: ttl, observe: observe, logger: logger}
+}
+
+// Get returns the album with the specified ID from the cache, or reads it from the repository if it is not cached.
+// Concurrent reads of the same uncached album are merged into one, so that a popular album expiring from the cache
+// does not cause a burst of reads from the storage. The albums cached are read from the primary database, because
+// a lagging read replica could bring back an album that was just removed from the cache. Reads within transactions
+// bypass the cache because they may see uncommitted changes.
+func (r *CachedRepository) Get(ctx context.Context, id string) (entity.Album, error) {
+	if dbcontext.InTransaction(ctx) {
+		return r.Repository.Get(ctx, id)
+	}
+	key := cacheKeyPrefix + id
+	if album, ok := r.cached(ctx, key); ok {
+		r.observe(true)
+		return album, nil
+	}
+	r.observe(false)
+
+	value, err, _ := r.group.Do(key, func() (interface{}, error) {
+		r.mu.RLock()
+		generation := r.generation
+		r.mu.RUnlock()
+		album, err := r.Repository.Get(dbcontext.WithPrimary(ctx), id)
+		if err == nil {
+			r.mu.RLock()
+			if r.generation == generation {
+				r.save(ctx, key, album)
+			}
+			r.mu.RUnlock()
+		}
+		return album, err
+	})
+	if err != nil && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// the merged read was run with the context of another request that was canceled
+		return r.Repository.Get(ctx, id)
+	}
+	return value.(entity.Album), err
+}
+
+// Create saves a new album in the repository.
+func (r *CachedRepository) Create(ctx context.Context, album entity.Album) error {
+	if err := r.Repository.Create(ctx, album); err != nil {
+		return err
+	}
+	r.invalidateOnCommit(ctx, album.ID)
+	return nil
+}
+
+// Update saves the changes to an album in the repository and removes the album from the cache once committed.
+func (r *CachedRepository) Update(ctx context.Context, album entity.Album) error {
+	if err := r.Repository.Update(ctx, album); err != nil {
+		return err
+	}
+	r.invalidateOnCommit(ctx, album.ID)
+	return nil
+}
+
+// Delete removes an album from the repository and from the cache once committed.
+func (r *CachedRepository) Delete(ctx context.Context, id string) error {
+	if err := r.Repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidateOnCommit(ctx, id)
+	return nil
+}
+
+// Invalidate removes the albums with the specified IDs from the cache.
+// The reads of the albums that are in progress are not cached.
+func (r *CachedRepository) Invalidate(ctx context.Context, ids ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cacheKeyPrefix + id
+		r.group.Forget(keys[i])
+	}
+	if err := r.store.Delete(ctx, keys...); err != nil {
+		r.logger.With(ctx).Errorf("failed to remove albums from the cache: %v", err)
+	}
+}
+
+// Watch removes the albums changed by other server instances from the cache as the broker delivers their events,
+// until the context is done or the broker is closed. If the broker disconnects the watcher because it fell behind,
+// the events missed are read from the storage.
+func (r *CachedRepository) Watch(ctx context.Context, broker *Broker) {
+	since, resume := broker.Last(), false
+	for {
+		sub := broker.Subscribe(EventFilter{})
+		if resume {
+			last, err := broker.Replay(ctx, since, EventFilter{}, func(event entity.AlbumEvent) error {
+				r.Invalidate(ctx, event.AlbumID)
+				return nil
+			})
+			if err != nil {
+				r.logger.Errorf("failed to read the album events missed by the cache: %v", err)
+			}
+			since = last
+		}
+	events:
+		for {
+			select {
+			case <-ctx.Done():
+				broker.Unsubscribe(sub)
+				return
+			case event, ok := <-sub.C():
+				if !ok {
+					break events
+				}
+				r.Invalidate(ctx, event.AlbumID)
+				since = event.Seq
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-broker.done:
+			return
+		default:
+			resume = true
+		}
+	}
+}
+
+// cached returns the album cached with the given key, if any. Failures of the cache are logged and treated as misses.
+func (r *CachedRepository) cached(ctx context.Context, key string) (entity.Album, bool) {
+	var album entity.Album
+	data, err := r.store.Get(ctx, key)
+	if err == nil {
+		err = json.Unmarshal(data, &album)
+	}
+	if err != nil && err != cache.ErrMiss {
+		r.logger.With(ctx).Errorf("failed to read an album from the cache: %v", err)
+	}
+	return album, err == nil
+}
+
+// save caches the given album with the given key. Failures of the cache are logged.
+func (r *CachedRepository) save(ctx context.Context, key string, album entity.Album) {
+	data, err := json.Marshal(album)
+	if err == nil {
+		err = r.store.Set(ctx, key, data, r.ttl)
+	}
+	if err != nil {
+		r.logger.With(ctx).Errorf("failed to cache an album: %v", err)
+	}
+}
+
+// invalidateOnCommit removes the album with the specified ID from the cache once the transaction in the given context,
+// if any, is committed.
+func (r *CachedRepository) invalidateOnCommit(ctx context.Context, id string) {
+	dbcontext.OnCommit(ctx, func() {
+		r.Invalidate(context.Background(), id)
+	})
+}
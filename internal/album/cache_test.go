@@ -0,0 +1,301 @@
+package album
+
+import (
+	"context"
+	"database/sql"
+	"github.com/alicebob/miniredis/v2"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/cache"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingRepository counts the reads of albums and blocks them until the release channel is closed, if set.
+type countingRepository struct {
+	Repository
+	gets    int32
+	release chan struct{}
+}
+
+func (r *countingRepository) Get(ctx context.Context, id string) (entity.Album, error) {
+	atomic.AddInt32(&r.gets, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.Repository.Get(ctx, id)
+}
+
+func TestCachedRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &countingRepository{Repository: NewMemoryRepository()}
+	var hits, misses int
+	cached := NewCachedRepository(repo, cache.NewLRU(10), time.Minute, func(hit bool) {
+		if hit {
+			hits++
+		} else {
+			misses++
+		}
+	}, logger)
+	testRepository(t, cached)
+
+	ctx := context.Background()
+	_ = cached.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+
+	// only the first read hits the repository
+	album, err := cached.Get(ctx, "cached1")
+	assert.Nil(t, err)
+	assert.Equal(t, "album1", album.Name)
+	gets := repo.gets
+	hits, misses = 0, 0
+	album, err = cached.Get(ctx, "cached1")
+	assert.Nil(t, err)
+	assert.Equal(t, "album1", album.Name)
+	assert.Equal(t, gets, repo.gets)
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 0, misses)
+
+	// update
+	assert.Nil(t, cached.Update(ctx, entity.Album{ID: "cached1", Name: "album1 updated"}))
+	album, _ = cached.Get(ctx, "cached1")
+	assert.Equal(t, "album1 updated", album.Name)
+	assert.Equal(t, 1, misses)
+
+	// changes not made via the cache are only seen after invalidation
+	_ = repo.Repository.Update(ctx, entity.Album{ID: "cached1", Name: "album1 changed"})
+	album, _ = cached.Get(ctx, "cached1")
+	assert.Equal(t, "album1 updated", album.Name)
+	cached.Invalidate(ctx, "cached1")
+	album, _ = cached.Get(ctx, "cached1")
+	assert.Equal(t, "album1 changed", album.Name)
+
+	// delete
+	assert.Nil(t, cached.Delete(ctx, "cached1"))
+	_, err = cached.Get(ctx, "cached1")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestCachedRepository_singleflight(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &countingRepository{Repository: NewMemoryRepository(), release: make(chan struct{})}
+	ctx := context.Background()
+	_ = repo.Repository.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+	cached := NewCachedRepository(repo, cache.NewLRU(10), time.Minute, nil, logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			album, err := cached.Get(ctx, "cached1")
+			assert.Nil(t, err)
+			assert.Equal(t, "album1", album.Name)
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&repo.gets) > 0 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&repo.gets))
+}
+
+func TestCachedRepository_staleRead(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &countingRepository{Repository: NewMemoryRepository(), release: make(chan struct{})}
+	ctx := context.Background()
+	_ = repo.Repository.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+	cached := NewCachedRepository(repo, cache.NewLRU(10), time.Minute, nil, logger)
+
+	// a read in progress when the album is invalidated is not cached
+	done := make(chan struct{})
+	go func() {
+		_, _ = cached.Get(ctx, "cached1")
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&repo.gets) > 0 }, time.Second, time.Millisecond)
+	cached.Invalidate(ctx, "cached1")
+	close(repo.release)
+	<-done
+	_, err := cached.store.Get(ctx, cacheKeyPrefix+"cached1")
+	assert.Equal(t, cache.ErrMiss, err)
+}
+
+// blockingStore blocks the caching of values until the release channel is closed, and reports when it has started.
+type blockingStore struct {
+	cache.Store
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s blockingStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	close(s.saving)
+	<-s.release
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+func TestCachedRepository_invalidateWhileSaving(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := NewMemoryRepository()
+	ctx := context.Background()
+	_ = repo.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+	store := blockingStore{Store: cache.NewLRU(10), saving: make(chan struct{}), release: make(chan struct{})}
+	cached := NewCachedRepository(repo, store, time.Minute, nil, logger)
+
+	// an invalidation happening while a read is being cached removes the album once it is cached
+	done := make(chan struct{})
+	go func() {
+		_, _ = cached.Get(ctx, "cached1")
+		close(done)
+	}()
+	<-store.saving
+	invalidated := make(chan struct{})
+	go func() {
+		cached.Invalidate(ctx, "cached1")
+		close(invalidated)
+	}()
+	select {
+	case <-invalidated:
+		t.Error("the album was invalidated while it was being cached")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(store.release)
+	<-done
+	<-invalidated
+	_, err := store.Store.Get(ctx, cacheKeyPrefix+"cached1")
+	assert.Equal(t, cache.ErrMiss, err)
+}
+
+func TestCachedRepository_transactional(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "album")
+	cached := NewCachedRepository(NewRepository(db, logger), cache.NewLRU(10), time.Minute, nil, logger)
+	ctx := context.Background()
+	assert.Nil(t, cached.Create(ctx, entity.Album{ID: "cached1", Name: "album1", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	_, _ = cached.Get(ctx, "cached1")
+
+	err := db.Transactional(ctx, func(ctx context.Context) error {
+		assert.Nil(t, cached.Update(ctx, entity.Album{ID: "cached1", Name: "album1 updated", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+		// the transaction sees its own changes, while the cache keeps the committed album until the commit
+		album, _ := cached.Get(ctx, "cached1")
+		assert.Equal(t, "album1 updated", album.Name)
+		album, _ = cached.Get(context.Background(), "cached1")
+		assert.Equal(t, "album1", album.Name)
+		return nil
+	})
+	assert.Nil(t, err)
+	album, _ := cached.Get(ctx, "cached1")
+	assert.Equal(t, "album1 updated", album.Name)
+}
+
+func TestCachedRepository_replica(t *testing.T) {
+	logger, _ := log.NewForTest()
+	// the replica lags behind the primary database and still has the album before it was updated
+	open := func(name string) *dbx.DB {
+		db, err := dbcontext.Open(":memory:", dbcontext.Options{Driver: "sqlite3"}, nil)
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		_, err = db.NewQuery("CREATE TABLE album (id TEXT PRIMARY KEY, name TEXT, created_at TIMESTAMP, updated_at TIMESTAMP)").Execute()
+		assert.Nil(t, err)
+		_, err = db.Insert("album", dbx.Params{"id": "cached1", "name": name, "created_at": time.Now(), "updated_at": time.Now()}).Execute()
+		assert.Nil(t, err)
+		return db
+	}
+	db := dbcontext.New(open("album1 updated"), open("album1"))
+	repo := NewRepository(db, logger)
+	cached := NewCachedRepository(repo, cache.NewLRU(10), time.Minute, nil, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/albums/cached1", nil)
+	c := routing.NewContext(httptest.NewRecorder(), req)
+	assert.Nil(t, db.ReplicaHandler()(c))
+	ctx := c.Request.Context()
+	album, _ := repo.Get(ctx, "cached1")
+	assert.Equal(t, "album1", album.Name, "the request reads from the replica")
+
+	// the album cached is read from the primary database
+	album, err := cached.Get(ctx, "cached1")
+	assert.Nil(t, err)
+	assert.Equal(t, "album1 updated", album.Name)
+	album, _ = cached.Get(ctx, "cached1")
+	assert.Equal(t, "album1 updated", album.Name)
+}
+
+func TestCachedRepository_Watch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := NewMemoryRepository()
+	events := NewMemoryEventRepository()
+	_ = repo.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+	cached := NewCachedRepository(repo, cache.NewLRU(10), time.Minute, nil, logger)
+	_, _ = cached.Get(ctx, "cached1")
+
+	broker := NewBroker(events, time.Second, logger)
+	notifications := make(chan string)
+	go func() {
+		_ = broker.Run(ctx, notifications)
+	}()
+	// wait until the broker has started
+	notifications <- ""
+	done := make(chan struct{})
+	go func() {
+		cached.Watch(ctx, broker)
+		close(done)
+	}()
+
+	// another server instance changes the album
+	_ = repo.Update(ctx, entity.Album{ID: "cached1", Name: "album1 updated"})
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumUpdated, AlbumID: "cached1"})
+	assert.Eventually(t, func() bool {
+		notifications <- ""
+		album, _ := cached.Get(ctx, "cached1")
+		return album.Name == "album1 updated"
+	}, time.Second, 10*time.Millisecond)
+
+	broker.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Watch did not stop after the broker was closed")
+	}
+}
+
+func TestCachedRepository_redis(t *testing.T) {
+	logger, _ := log.NewForTest()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	_ = repo.Create(ctx, entity.Album{ID: "cached1", Name: "album1"})
+
+	// the server instances sharing Redis see the invalidations made by each other
+	store := cache.NewRedis(client, "test:")
+	cached1 := NewCachedRepository(repo, store, time.Minute, nil, logger)
+	cached2 := NewCachedRepository(repo, store, time.Minute, nil, logger)
+	album, err := cached1.Get(ctx, "cached1")
+	assert.Nil(t, err)
+	assert.Equal(t, "album1", album.Name)
+	assert.True(t, mr.Exists("test:album:cached1"))
+	assert.Nil(t, cached2.Update(ctx, entity.Album{ID: "cached1", Name: "album1 updated"}))
+	assert.False(t, mr.Exists("test:album:cached1"))
+	album, _ = cached1.Get(ctx, "cached1")
+	assert.Equal(t, "album1 updated", album.Name)
+
+	// a failing cache falls back to the repository
+	mr.Close()
+	album, err = cached1.Get(ctx, "cached1")
+	assert.Nil(t, err)
+	assert.Equal(t, "album1 updated", album.Name)
+}
@@ -0,0 +1,128 @@
+package album
+
+import (
+	"context"
+	"encoding/json"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// EventChannel is the PostgreSQL notification channel on which the sequence numbers of new album events are announced.
+const EventChannel = "album_event"
+
+// eventLockKey is the key of the PostgreSQL advisory lock which serializes the creation of album events.
+const eventLockKey = 4727193650148203917
+
+// EventRepository encapsulates the logic to access album events from the data source.
+type EventRepository interface {
+	// Create saves a new album event in the storage. The events must become visible in the order of their
+	// sequence numbers, because the readers skip the events whose sequence numbers are below the latest one read.
+	Create(ctx context.Context, event entity.AlbumEvent) error
+	// Query returns at most limit events whose sequence numbers are greater than since, in the order of the sequence numbers.
+	Query(ctx context.Context, since int64, limit int) ([]entity.AlbumEvent, error)
+	// Last returns the sequence number of the latest event, or 0 if there is no event.
+	Last(ctx context.Context) (int64, error)
+}
+
+// eventRecord is the database representation of an album event.
+type eventRecord struct {
+	Seq       int64 `db:"pk"`
+	Type      string
+	AlbumID   string
+	UserID    string
+	Payload   string
+	CreatedAt time.Time
+}
+
+// TableName returns the name of the table storing album events.
+func (eventRecord) TableName() string {
+	return "album_event"
+}
+
+// eventRepository persists album events in database
+type eventRepository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewEventRepository creates a new album event repository
+func NewEventRepository(db *dbcontext.DB, logger log.Logger) EventRepository {
+	return eventRepository{db, logger}
+}
+
+// Create saves a new album event record in the database.
+// The sequence number of the event is generated by the database. Because concurrent transactions may commit
+// their sequence numbers out of order, the creation of events is serialized until the end of the transaction
+// in the context, so that the events are committed in the order of their sequence numbers. The event is created
+// in a new transaction if the context has none.
+func (r eventRepository) Create(ctx context.Context, event entity.AlbumEvent) error {
+	payload, err := json.Marshal(event.Album)
+	if err != nil {
+		return err
+	}
+	record := eventRecord{
+		Type:      event.Type,
+		AlbumID:   event.AlbumID,
+		UserID:    event.UserID,
+		Payload:   string(payload),
+		CreatedAt: event.CreatedAt,
+	}
+	if !dbcontext.InTransaction(ctx) {
+		return r.db.Transactional(ctx, func(ctx context.Context) error {
+			return r.create(ctx, &record)
+		})
+	}
+	return r.create(ctx, &record)
+}
+
+// create inserts the album event record once the other transactions creating events have ended.
+func (r eventRepository) create(ctx context.Context, record *eventRecord) error {
+	// SQLite serializes the transactions writing to the database instead
+	if r.db.DB().DriverName() == "postgres" {
+		_, err := r.db.With(ctx).NewQuery("SELECT pg_advisory_xact_lock({:key})").
+			Bind(dbx.Params{"key": eventLockKey}).
+			Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return r.db.With(ctx).Model(record).Insert()
+}
+
+// Query retrieves the album event records that come after the specified sequence number from the database.
+func (r eventRepository) Query(ctx context.Context, since int64, limit int) ([]entity.AlbumEvent, error) {
+	var records []eventRecord
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.NewExp("seq>{:seq}", dbx.Params{"seq": since})).
+		OrderBy("seq").
+		Limit(int64(limit)).
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]entity.AlbumEvent, len(records))
+	for i, record := range records {
+		events[i] = entity.AlbumEvent{
+			Seq:       record.Seq,
+			Type:      record.Type,
+			AlbumID:   record.AlbumID,
+			UserID:    record.UserID,
+			CreatedAt: record.CreatedAt,
+		}
+		if err := json.Unmarshal([]byte(record.Payload), &events[i].Album); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// Last returns the largest sequence number of the album event records in the database.
+func (r eventRepository) Last(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.db.With(ctx).Select("COALESCE(MAX(seq), 0)").From("album_event").Row(&seq)
+	return seq, err
+}
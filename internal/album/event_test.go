@@ -0,0 +1,119 @@
+package album
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEventRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.Fixtures(t, db, "album", "album_event")
+	repo := NewEventRepository(db, logger)
+
+	ctx := context.Background()
+
+	// initial sequence number
+	last, err := repo.Last(ctx)
+	assert.Nil(t, err)
+
+	// fixture
+	events, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "fixture1", events[0].AlbumID)
+		assert.Equal(t, "fixture album 1", events[0].Album.Name)
+		assert.Equal(t, last, events[0].Seq)
+	}
+
+	// create
+	err = repo.Create(ctx, entity.AlbumEvent{
+		Type:      entity.AlbumCreated,
+		AlbumID:   "test1",
+		UserID:    "100",
+		Album:     entity.Album{ID: "test1", Name: "album1"},
+		CreatedAt: time.Now(),
+	})
+	assert.Nil(t, err)
+	err = repo.Create(ctx, entity.AlbumEvent{
+		Type:      entity.AlbumDeleted,
+		AlbumID:   "test1",
+		Album:     entity.Album{ID: "test1", Name: "album1"},
+		CreatedAt: time.Now(),
+	})
+	assert.Nil(t, err)
+
+	// query
+	events, err = repo.Query(ctx, last, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(events)) {
+		assert.Equal(t, entity.AlbumCreated, events[0].Type)
+		assert.Equal(t, "test1", events[0].AlbumID)
+		assert.Equal(t, "100", events[0].UserID)
+		assert.Equal(t, "album1", events[0].Album.Name)
+		assert.Equal(t, entity.AlbumDeleted, events[1].Type)
+		assert.True(t, events[0].Seq < events[1].Seq)
+
+		events2, err := repo.Query(ctx, events[0].Seq, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, events[1:], events2)
+
+		last, err = repo.Last(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, events[1].Seq, last)
+	}
+	events, err = repo.Query(ctx, last, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+}
+
+func TestEventRepository_order(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "album_event")
+	repo := NewEventRepository(db, logger)
+	ctx := context.Background()
+	event := func(id string) entity.AlbumEvent {
+		return entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: id, Album: entity.Album{ID: id}, CreatedAt: time.Now()}
+	}
+
+	// the first transaction creates an event and commits only after another event has been created
+	created, commit, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		err := db.Transactional(ctx, func(ctx context.Context) error {
+			err := repo.Create(ctx, event("first"))
+			close(created)
+			if err != nil {
+				return err
+			}
+			<-commit
+			return nil
+		})
+		assert.Nil(t, err)
+	}()
+	<-created
+	go func() {
+		assert.Nil(t, repo.Create(ctx, event("second")))
+		close(done)
+	}()
+
+	// the second event is not committed before the first one, whose sequence number is smaller
+	select {
+	case <-done:
+		t.Error("the second event was committed before the first one")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(commit)
+	<-done
+	events, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "first", events[0].AlbumID)
+		assert.Equal(t, "second", events[1].AlbumID)
+	}
+}
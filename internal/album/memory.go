@@ -0,0 +1,141 @@
+package album
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"sort"
+	"sync"
+)
+
+// memoryRepository keeps albums in memory. It is safe for concurrent use.
+type memoryRepository struct {
+	mu     sync.RWMutex
+	albums map[string]entity.Album
+}
+
+// NewMemoryRepository creates a new album repository that keeps the albums in memory, such as for running the server
+// in demos or frontend development without a database. The albums are lost when the server stops.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{albums: map[string]entity.Album{}}
+}
+
+// Get returns the album with the specified ID, or sql.ErrNoRows if it does not exist.
+func (r *memoryRepository) Get(ctx context.Context, id string) (entity.Album, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	album, ok := r.albums[id]
+	if !ok {
+		return entity.Album{}, sql.ErrNoRows
+	}
+	return album, nil
+}
+
+// Count returns the number of albums.
+func (r *memoryRepository) Count(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.albums), nil
+}
+
+// Query returns the albums with the specified offset and limit, ordered by their IDs.
+// A negative limit means no limit.
+func (r *memoryRepository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
+	r.mu.RLock()
+	albums := make([]entity.Album, 0, len(r.albums))
+	for _, album := range r.albums {
+		albums = append(albums, album)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(albums) {
+		offset = len(albums)
+	}
+	albums = albums[offset:]
+	if limit >= 0 && limit < len(albums) {
+		albums = albums[:limit]
+	}
+	return albums, nil
+}
+
+// Create saves a new album. It fails if an album with the same ID exists.
+func (r *memoryRepository) Create(ctx context.Context, album entity.Album) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.albums[album.ID]; ok {
+		return errors.AlreadyExists("id", nil)
+	}
+	r.albums[album.ID] = album
+	return nil
+}
+
+// Update saves the changes to an album. Like an UPDATE statement, it does nothing if the album does not exist.
+func (r *memoryRepository) Update(ctx context.Context, album entity.Album) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.albums[album.ID]; ok {
+		r.albums[album.ID] = album
+	}
+	return nil
+}
+
+// Delete removes the album with the specified ID, or returns sql.ErrNoRows if it does not exist.
+func (r *memoryRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.albums[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.albums, id)
+	return nil
+}
+
+// memoryEventRepository keeps album events in memory. It is safe for concurrent use.
+type memoryEventRepository struct {
+	mu     sync.RWMutex
+	events []entity.AlbumEvent
+}
+
+// NewMemoryEventRepository creates a new album event repository that keeps the events in memory.
+// The events are lost when the server stops.
+func NewMemoryEventRepository() EventRepository {
+	return &memoryEventRepository{}
+}
+
+// Create saves a new album event. The sequence numbers of the events start from 1.
+func (r *memoryEventRepository) Create(ctx context.Context, event entity.AlbumEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.Seq = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return nil
+}
+
+// Query returns at most limit events whose sequence numbers are greater than since, in the order of the sequence numbers.
+func (r *memoryEventRepository) Query(ctx context.Context, since int64, limit int) ([]entity.AlbumEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if since < 0 {
+		since = 0
+	}
+	if since > int64(len(r.events)) {
+		since = int64(len(r.events))
+	}
+	events := r.events[since:]
+	if limit >= 0 && limit < len(events) {
+		events = events[:limit]
+	}
+	return append([]entity.AlbumEvent(nil), events...), nil
+}
+
+// Last returns the sequence number of the latest event, or 0 if there is no event.
+func (r *memoryEventRepository) Last(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int64(len(r.events)), nil
+}
@@ -0,0 +1,78 @@
+package album
+
+import (
+	"context"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, NewMemoryRepository())
+
+	// duplicates are reported as conflicts of the ID
+	repo := NewMemoryRepository()
+	assert.Nil(t, repo.Create(context.Background(), entity.Album{ID: "a"}))
+	err := repo.Create(context.Background(), entity.Album{ID: "a"})
+	if assert.IsType(t, &errors.DomainError{}, err) {
+		assert.Equal(t, errors.CodeAlreadyExists, err.(*errors.DomainError).Code)
+		assert.Equal(t, "id", err.(*errors.DomainError).Field)
+	}
+}
+
+func TestMemoryRepository_concurrent(t *testing.T) {
+	repo := NewMemoryRepository()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("%02d", i)
+			assert.Nil(t, repo.Create(ctx, entity.Album{ID: id}))
+			_, _ = repo.Query(ctx, 0, 10)
+			assert.Nil(t, repo.Update(ctx, entity.Album{ID: id, Name: "updated"}))
+		}(i)
+	}
+	wg.Wait()
+	count, _ := repo.Count(ctx)
+	assert.Equal(t, 50, count)
+	albums, _ := repo.Query(ctx, 10, 5)
+	if assert.Len(t, albums, 5) {
+		assert.Equal(t, "10", albums[0].ID)
+		assert.Equal(t, "updated", albums[0].Name)
+	}
+}
+
+func TestMemoryEventRepository(t *testing.T) {
+	repo := NewMemoryEventRepository()
+	ctx := context.Background()
+
+	last, err := repo.Last(ctx)
+	assert.Nil(t, err)
+	assert.Zero(t, last)
+
+	for _, id := range []string{"a", "b", "c"} {
+		err := repo.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: id, Album: entity.Album{ID: id}})
+		assert.Nil(t, err)
+	}
+	last, _ = repo.Last(ctx)
+	assert.Equal(t, int64(3), last)
+
+	events, err := repo.Query(ctx, 1, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, int64(2), events[0].Seq)
+		assert.Equal(t, "b", events[0].AlbumID)
+		assert.Equal(t, int64(3), events[1].Seq)
+	}
+	events, _ = repo.Query(ctx, 0, 1)
+	assert.Len(t, events, 1)
+	events, _ = repo.Query(ctx, 3, 10)
+	assert.Empty(t, events)
+	events, _ = repo.Query(ctx, 5, 10)
+	assert.Empty(t, events)
+}
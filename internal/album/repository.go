@@ -3,10 +3,16 @@ package album
 import (
 	"context"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 )
 
+func init() {
+	// report the violations of the album table constraints in terms of the API fields
+	errors.RegisterConstraint("album_pkey", "id")
+}
+
 // Repository encapsulates the logic to access albums from the data source.
 type Repository interface {
 	// Get returns the album with the specified album ID.
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/stretchr/testify/assert"
@@ -14,7 +15,7 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "album")
+	test.Fixtures(t, db, "album")
 	repo := NewRepository(db, logger)
 
 	ctx := context.Background()
@@ -22,6 +23,12 @@ func TestRepository(t *testing.T) {
 	// initial count
 	count, err := repo.Count(ctx)
 	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// fixture
+	album, err := repo.Get(ctx, "fixture1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fixture album 1", album.Name)
 
 	// create
 	err = repo.Create(ctx, entity.Album{
@@ -35,7 +42,7 @@ func TestRepository(t *testing.T) {
 	assert.Equal(t, 1, count2-count)
 
 	// get
-	album, err := repo.Get(ctx, "test1")
+	album, err = repo.Get(ctx, "test1")
 	assert.Nil(t, err)
 	assert.Equal(t, "album1", album.Name)
 	_, err = repo.Get(ctx, "test0")
@@ -65,3 +72,86 @@ func TestRepository(t *testing.T) {
 	err = repo.Delete(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
 }
+
+func TestRepository_conformance(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "album")
+	testRepository(t, NewRepository(db, logger))
+}
+
+// testRepository verifies the behavior of an empty repository. It is run against every Repository implementation
+// so that they behave identically.
+func testRepository(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	ids := func(albums []entity.Album) []string {
+		result := []string{}
+		for _, album := range albums {
+			result = append(result, album.ID)
+		}
+		return result
+	}
+
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+	albums, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, albums)
+
+	// create
+	now := time.Now()
+	for _, id := range []string{"c", "a", "e", "b", "d"} {
+		err := repo.Create(ctx, entity.Album{ID: id, Name: "album " + id, CreatedAt: now, UpdatedAt: now})
+		assert.Nil(t, err)
+	}
+	err = repo.Create(ctx, entity.Album{ID: "a", Name: "duplicate", CreatedAt: now, UpdatedAt: now})
+	assert.Equal(t, errors.CodeAlreadyExists, errors.Code(err))
+	count, err = repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+
+	// get
+	album, err := repo.Get(ctx, "c")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", album.ID)
+	assert.Equal(t, "album c", album.Name)
+	_, err = repo.Get(ctx, "x")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query: ordered by ID and paged
+	albums, err = repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ids(albums))
+	albums, err = repo.Query(ctx, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, ids(albums))
+	albums, err = repo.Query(ctx, 4, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e"}, ids(albums))
+	albums, err = repo.Query(ctx, 5, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, albums)
+
+	// update
+	err = repo.Update(ctx, entity.Album{ID: "b", Name: "album b updated", CreatedAt: now, UpdatedAt: now})
+	assert.Nil(t, err)
+	album, err = repo.Get(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "album b updated", album.Name)
+	assert.Nil(t, repo.Update(ctx, entity.Album{ID: "x", Name: "none", CreatedAt: now, UpdatedAt: now}))
+	_, err = repo.Get(ctx, "x")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "b"))
+	_, err = repo.Get(ctx, "b")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(ctx, "b"))
+	count, err = repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+	albums, err = repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c", "d", "e"}, ids(albums))
+}
@@ -2,12 +2,19 @@ package album
 
 import (
 	"context"
+	"database/sql"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"time"
 )
 
+// CodeAlbumNotFound is the error code indicating that the requested album does not exist.
+const CodeAlbumNotFound = "ALBUM_NOT_FOUND"
+
 // Service encapsulates usecase logic for albums.
 type Service interface {
 	Get(ctx context.Context, id string) (Album, error)
@@ -48,18 +55,24 @@ func (m UpdateAlbumRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	events        EventRepository
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
 }
 
 // NewService creates a new album service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// Every change made to the albums is recorded as an album event in the same transaction.
+func NewService(repo Repository, events EventRepository, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, events, transactional, logger}
 }
 
 // Get returns the album with the specified the album ID.
 func (s service) Get(ctx context.Context, id string) (Album, error) {
 	album, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return Album{}, errors.NewDomainError(errors.KindNotFound, CodeAlbumNotFound, "The album was not found.", err)
+	}
 	if err != nil {
 		return Album{}, err
 	}
@@ -73,11 +86,17 @@ func (s service) Create(ctx context.Context, req CreateAlbumRequest) (Album, err
 	}
 	id := entity.GenerateID()
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.Album{
+	album := entity.Album{
 		ID:        id,
 		Name:      req.Name,
 		CreatedAt: now,
 		UpdatedAt: now,
+	}
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, album); err != nil {
+			return err
+		}
+		return s.events.Create(ctx, newEvent(ctx, entity.AlbumCreated, album))
 	})
 	if err != nil {
 		return Album{}, err
@@ -98,7 +117,13 @@ func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest)
 	album.Name = req.Name
 	album.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(ctx, album.Album); err != nil {
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, album.Album); err != nil {
+			return err
+		}
+		return s.events.Create(ctx, newEvent(ctx, entity.AlbumUpdated, album.Album))
+	})
+	if err != nil {
 		return album, err
 	}
 	return album, nil
@@ -110,7 +135,13 @@ func (s service) Delete(ctx context.Context, id string) (Album, error) {
 	if err != nil {
 		return Album{}, err
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.events.Create(ctx, newEvent(ctx, entity.AlbumDeleted, album.Album))
+	})
+	if err != nil {
 		return Album{}, err
 	}
 	return album, nil
@@ -133,3 +164,17 @@ func (s service) Query(ctx context.Context, offset, limit int) ([]Album, error)
 	}
 	return result, nil
 }
+
+// newEvent creates an event recording the change made to an album by the current user.
+func newEvent(ctx context.Context, eventType string, album entity.Album) entity.AlbumEvent {
+	event := entity.AlbumEvent{
+		Type:      eventType,
+		AlbumID:   album.ID,
+		Album:     album,
+		CreatedAt: time.Now(),
+	}
+	if user := auth.CurrentUser(ctx); user != nil {
+		event.UserID = user.GetID()
+	}
+	return event
+}
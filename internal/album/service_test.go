@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
 )
 
@@ -50,7 +52,8 @@ func TestUpdateAlbumRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	events := &mockEventRepository{}
+	s := NewService(&mockRepository{}, events, mockTransactional, logger)
 
 	ctx := context.Background()
 
@@ -68,6 +71,10 @@ func Test_service_CRUD(t *testing.T) {
 	assert.NotEmpty(t, album.UpdatedAt)
 	count, _ = s.Count(ctx)
 	assert.Equal(t, 1, count)
+	if assert.Equal(t, 1, len(events.items)) {
+		assert.Equal(t, entity.AlbumCreated, events.items[0].Type)
+		assert.Equal(t, id, events.items[0].AlbumID)
+	}
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateAlbumRequest{Name: ""})
@@ -80,6 +87,7 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, errCRUD, err)
 	count, _ = s.Count(ctx)
 	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, len(events.items))
 
 	_, _ = s.Create(ctx, CreateAlbumRequest{Name: "test2"})
 
@@ -87,6 +95,10 @@ func Test_service_CRUD(t *testing.T) {
 	album, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "test updated"})
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
+	if assert.Equal(t, 3, len(events.items)) {
+		assert.Equal(t, entity.AlbumUpdated, events.items[2].Type)
+		assert.Equal(t, "test updated", events.items[2].Album.Name)
+	}
 	_, err = s.Update(ctx, "none", UpdateAlbumRequest{Name: "test updated"})
 	assert.NotNil(t, err)
 
@@ -104,7 +116,7 @@ func Test_service_CRUD(t *testing.T) {
 
 	// get
 	_, err = s.Get(ctx, "none")
-	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
 	album, err = s.Get(ctx, id)
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
@@ -122,6 +134,22 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, id, album.ID)
 	count, _ = s.Count(ctx)
 	assert.Equal(t, 1, count)
+	if assert.Equal(t, 4, len(events.items)) {
+		assert.Equal(t, entity.AlbumDeleted, events.items[3].Type)
+		assert.Equal(t, id, events.items[3].AlbumID)
+	}
+}
+
+func Test_newEvent(t *testing.T) {
+	album := entity.Album{ID: "123", Name: "album123"}
+	event := newEvent(context.Background(), entity.AlbumCreated, album)
+	assert.Equal(t, entity.AlbumCreated, event.Type)
+	assert.Equal(t, "123", event.AlbumID)
+	assert.Equal(t, album, event.Album)
+	assert.Empty(t, event.UserID)
+
+	event = newEvent(auth.WithUser(context.Background(), "100", "Tester"), entity.AlbumDeleted, album)
+	assert.Equal(t, "100", event.UserID)
 }
 
 type mockRepository struct {
@@ -176,3 +204,38 @@ func (m *mockRepository) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+type mockEventRepository struct {
+	mu    sync.Mutex
+	items []entity.AlbumEvent
+}
+
+func (m *mockEventRepository) Create(ctx context.Context, event entity.AlbumEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.Seq = int64(len(m.items) + 1)
+	m.items = append(m.items, event)
+	return nil
+}
+
+func (m *mockEventRepository) Query(ctx context.Context, since int64, limit int) ([]entity.AlbumEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []entity.AlbumEvent
+	for _, item := range m.items {
+		if item.Seq > since && len(events) < limit {
+			events = append(events, item)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockEventRepository) Last(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.items)), nil
+}
+
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
@@ -0,0 +1,233 @@
+package album
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	// replayBatchSize is the number of events read from the storage at a time.
+	replayBatchSize = 100
+	// subscriptionBufferSize is the number of events that may be queued for a subscriber.
+	// A subscriber that falls further behind is disconnected and expected to resume from the storage.
+	subscriptionBufferSize = 64
+	// pollInterval is the interval of checking the storage for new events in case a notification is missed.
+	pollInterval = 5 * time.Second
+	// minStartDelay is the delay before retrying to start the broker, which doubles with each attempt up to pollInterval.
+	minStartDelay = 100 * time.Millisecond
+)
+
+// EventFilter specifies which album events a subscriber is interested in.
+type EventFilter struct {
+	// AlbumIDs lists the IDs of the albums whose events should be delivered. Empty means all albums.
+	AlbumIDs []string
+	// UserID is the ID of the user whose changes should be delivered. Empty means all users.
+	UserID string
+}
+
+// Match returns whether the given event satisfies the filter.
+func (f EventFilter) Match(event entity.AlbumEvent) bool {
+	if f.UserID != "" && f.UserID != event.UserID {
+		return false
+	}
+	if len(f.AlbumIDs) == 0 {
+		return true
+	}
+	for _, id := range f.AlbumIDs {
+		if id == event.AlbumID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription represents a subscriber of the album change feed.
+type Subscription struct {
+	filter EventFilter
+	c      chan entity.AlbumEvent
+}
+
+// C returns the channel delivering the events matching the subscription filter.
+// The channel is closed when the broker is closed or when the subscriber falls too far behind.
+func (s *Subscription) C() <-chan entity.AlbumEvent {
+	return s.c
+}
+
+// Broker fans out album events to the subscribers of the album change feed.
+//
+// The broker reads new events from the storage whenever it is notified about them.
+// Because the events are persisted with increasing sequence numbers, every server instance
+// sharing the storage delivers the same events in the same order.
+type Broker struct {
+	events    EventRepository
+	heartbeat time.Duration
+	logger    log.Logger
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	last   int64
+	closed bool
+	done   chan struct{}
+}
+
+// NewBroker creates a new album event broker.
+// The heartbeat interval determines how often an idle stream sends a heartbeat to keep the connection alive.
+func NewBroker(events EventRepository, heartbeat time.Duration, logger log.Logger) *Broker {
+	return &Broker{
+		events:    events,
+		heartbeat: heartbeat,
+		logger:    logger,
+		subs:      map[*Subscription]struct{}{},
+		done:      make(chan struct{}),
+	}
+}
+
+// Run delivers new events to the subscribers until the context is done or the broker is closed.
+// Each value received from the notifications channel triggers a check for new events in the storage.
+// The storage is also checked periodically in case a notification is missed. If the storage is unavailable
+// when the broker starts, such as while the database is starting, the broker keeps retrying to start.
+func (b *Broker) Run(ctx context.Context, notifications <-chan string) error {
+	for delay := minStartDelay; ; delay *= 2 {
+		last, err := b.events.Last(ctx)
+		if err == nil {
+			b.mu.Lock()
+			b.last = last
+			b.mu.Unlock()
+			break
+		}
+		if delay > pollInterval {
+			delay = pollInterval
+		}
+		b.logger.Errorf("failed to start the album change feed, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			b.Close()
+			return nil
+		case <-b.done:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.Close()
+			return nil
+		case <-b.done:
+			return nil
+		case _, ok := <-notifications:
+			if !ok {
+				notifications = nil
+			}
+		case <-ticker.C:
+		}
+		if err := b.dispatch(ctx); err != nil {
+			b.logger.Errorf("failed to dispatch album events: %v", err)
+		}
+	}
+}
+
+// Last returns the sequence number of the latest event delivered by the broker.
+func (b *Broker) Last() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+// Subscribe registers a new subscriber that receives the new events matching the given filter.
+// Unsubscribe should be called once the subscriber is no longer interested in the events.
+func (b *Broker) Subscribe(filter EventFilter) *Subscription {
+	sub := &Subscription{filter, make(chan entity.AlbumEvent, subscriptionBufferSize)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.c)
+	} else {
+		b.subs[sub] = struct{}{}
+	}
+	return sub
+}
+
+// Unsubscribe removes the given subscriber.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Replay calls the given function for each stored event that comes after the given sequence number
+// and matches the filter. It returns the sequence number of the last event read from the storage.
+func (b *Broker) Replay(ctx context.Context, since int64, filter EventFilter, f func(entity.AlbumEvent) error) (int64, error) {
+	for {
+		events, err := b.events.Query(ctx, since, replayBatchSize)
+		if err != nil {
+			return since, err
+		}
+		for _, event := range events {
+			if filter.Match(event) {
+				if err := f(event); err != nil {
+					return since, err
+				}
+			}
+			since = event.Seq
+		}
+		if len(events) < replayBatchSize {
+			return since, nil
+		}
+	}
+}
+
+// Close disconnects all subscribers and stops delivering events.
+// It is meant to be called when the server shuts down so that the open streams can be closed gracefully.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// dispatch reads the events that have not been delivered yet and sends them to the matching subscribers.
+func (b *Broker) dispatch(ctx context.Context) error {
+	for {
+		events, err := b.events.Query(ctx, b.Last(), replayBatchSize)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		for _, event := range events {
+			for sub := range b.subs {
+				if !sub.filter.Match(event) {
+					continue
+				}
+				select {
+				case sub.c <- event:
+				default:
+					b.logger.Infof("disconnecting a slow subscriber of the album change feed at event %v", event.Seq)
+					delete(b.subs, sub)
+					close(sub.c)
+				}
+			}
+			b.last = event.Seq
+		}
+		b.mu.Unlock()
+		if len(events) < replayBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package album
+
+import (
+	"context"
+	"errors"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventFilter_Match(t *testing.T) {
+	event := entity.AlbumEvent{AlbumID: "123", UserID: "100"}
+	assert.True(t, EventFilter{}.Match(event))
+	assert.True(t, EventFilter{AlbumIDs: []string{"456", "123"}}.Match(event))
+	assert.False(t, EventFilter{AlbumIDs: []string{"456"}}.Match(event))
+	assert.True(t, EventFilter{UserID: "100"}.Match(event))
+	assert.False(t, EventFilter{UserID: "200"}.Match(event))
+	assert.False(t, EventFilter{AlbumIDs: []string{"123"}, UserID: "200"}.Match(event))
+}
+
+func TestBroker(t *testing.T) {
+	logger, _ := log.NewForTest()
+	events := &mockEventRepository{}
+	ctx := context.Background()
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "123"})
+
+	broker := NewBroker(events, time.Second, logger)
+	notifications := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- broker.Run(ctx, notifications)
+	}()
+
+	// wait until the broker has started
+	notifications <- ""
+	all := broker.Subscribe(EventFilter{})
+	filtered := broker.Subscribe(EventFilter{AlbumIDs: []string{"456"}})
+
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "456"})
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumUpdated, AlbumID: "123"})
+	notifications <- "3"
+
+	// the event stored before the broker started is not delivered
+	assert.Equal(t, int64(2), receive(t, all).Seq)
+	assert.Equal(t, int64(3), receive(t, all).Seq)
+	assert.Equal(t, int64(2), receive(t, filtered).Seq)
+	assert.Equal(t, int64(3), broker.Last())
+
+	// unsubscribed subscribers no longer receive events
+	broker.Unsubscribe(filtered)
+	_, ok := <-filtered.C()
+	assert.False(t, ok)
+
+	// closing the broker disconnects the subscribers and stops the broker
+	broker.Close()
+	_, ok = <-all.C()
+	assert.False(t, ok)
+	assert.Nil(t, <-done)
+	_, ok = <-broker.Subscribe(EventFilter{}).C()
+	assert.False(t, ok)
+}
+
+// unavailableEventRepository fails to read the latest event a given number of times.
+type unavailableEventRepository struct {
+	mockEventRepository
+	failures int32
+}
+
+func (m *unavailableEventRepository) Last(ctx context.Context) (int64, error) {
+	if atomic.AddInt32(&m.failures, -1) >= 0 {
+		return 0, errors.New("database unavailable")
+	}
+	return m.mockEventRepository.Last(ctx)
+}
+
+func TestBroker_Run_retry(t *testing.T) {
+	logger, entries := log.NewForTest()
+	events := &unavailableEventRepository{failures: 2}
+	ctx := context.Background()
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "123"})
+	broker := NewBroker(events, time.Second, logger)
+	notifications := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- broker.Run(ctx, notifications)
+	}()
+
+	// the broker starts once the storage becomes available
+	notifications <- ""
+	assert.Equal(t, int64(1), broker.Last())
+	assert.Equal(t, 2, entries.FilterMessageSnippet("retrying").Len())
+	broker.Close()
+	assert.Nil(t, <-done)
+
+	// the broker stops retrying when closed
+	events = &unavailableEventRepository{failures: 1000}
+	broker = NewBroker(events, time.Second, logger)
+	go func() {
+		done <- broker.Run(ctx, nil)
+	}()
+	broker.Close()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Error("the broker did not stop after being closed")
+	}
+}
+
+func TestBroker_slowSubscriber(t *testing.T) {
+	logger, _ := log.NewForTest()
+	events := &mockEventRepository{}
+	ctx := context.Background()
+	broker := NewBroker(events, time.Second, logger)
+	sub := broker.Subscribe(EventFilter{})
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "123"})
+	}
+	assert.Nil(t, broker.dispatch(ctx))
+
+	// the subscriber is disconnected after its buffer is full
+	count := 0
+	for range sub.C() {
+		count++
+	}
+	assert.Equal(t, subscriptionBufferSize, count)
+	assert.Equal(t, int64(subscriptionBufferSize+1), broker.Last())
+}
+
+func TestBroker_Replay(t *testing.T) {
+	logger, _ := log.NewForTest()
+	events := &mockEventRepository{}
+	ctx := context.Background()
+	for i := 0; i < replayBatchSize+10; i++ {
+		_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumCreated, AlbumID: "123"})
+	}
+	_ = events.Create(ctx, entity.AlbumEvent{Type: entity.AlbumDeleted, AlbumID: "456"})
+	broker := NewBroker(events, time.Second, logger)
+
+	var replayed []entity.AlbumEvent
+	last, err := broker.Replay(ctx, 5, EventFilter{}, func(event entity.AlbumEvent) error {
+		replayed = append(replayed, event)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(replayBatchSize+11), last)
+	assert.Equal(t, replayBatchSize+6, len(replayed))
+	assert.Equal(t, int64(6), replayed[0].Seq)
+
+	replayed = nil
+	last, err = broker.Replay(ctx, 0, EventFilter{AlbumIDs: []string{"456"}}, func(event entity.AlbumEvent) error {
+		replayed = append(replayed, event)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(replayBatchSize+11), last)
+	if assert.Equal(t, 1, len(replayed)) {
+		assert.Equal(t, entity.AlbumDeleted, replayed[0].Type)
+	}
+}
+
+func receive(t *testing.T, sub *Subscription) entity.AlbumEvent {
+	select {
+	case event := <-sub.C():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an album event")
+	}
+	return entity.AlbumEvent{}
+}
@@ -2,12 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"github.com/dgrijalva/jwt-go"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"net/http"
+	"strings"
 )
 
 // Handler returns a JWT-based authentication middleware.
@@ -15,6 +17,43 @@ func Handler(verificationKey string) routing.Handler {
 	return auth.JWT(verificationKey, auth.JWTOptions{TokenHandler: handleToken})
 }
 
+// IdentityHandler returns a middleware that identifies the user by the JWT in the Authorization header, if any.
+// Unlike Handler, it does not reject requests with a missing or invalid token. It is meant for middlewares that
+// need to know the user before the request reaches the authentication middleware of a route.
+func IdentityHandler(verificationKey string) routing.Handler {
+	parser := &jwt.Parser{ValidMethods: []string{"HS256"}}
+	return func(c *routing.Context) error {
+		header := c.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return nil
+		}
+		token, err := parser.Parse(header[7:], func(*jwt.Token) (interface{}, error) { return []byte(verificationKey), nil })
+		if err != nil || !token.Valid {
+			return nil
+		}
+		claims, _ := token.Claims.(jwt.MapClaims)
+		id, _ := claims["id"].(string)
+		name, _ := claims["name"].(string)
+		if id != "" {
+			c.Request = c.Request.WithContext(WithUser(c.Request.Context(), id, name))
+		}
+		return nil
+	}
+}
+
+// TokenHandler returns a middleware that only allows the requests bearing the given static token in the
+// Authorization header, such as the token protecting the admin endpoints.
+func TokenHandler(token string) routing.Handler {
+	return func(c *routing.Context) error {
+		header := c.Request.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(header, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(header[7:]), []byte(token)) != 1 {
+			return errors.Unauthorized("")
+		}
+		return nil
+	}
+}
+
 // handleToken stores the user identity in the request context so that it can be accessed elsewhere.
 func handleToken(c *routing.Context, token *jwt.Token) error {
 	ctx := WithUser(
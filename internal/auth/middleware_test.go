@@ -24,6 +24,67 @@ func TestHandler(t *testing.T) {
 	assert.NotNil(t, Handler("test"))
 }
 
+func TestIdentityHandler(t *testing.T) {
+	h := IdentityHandler("test")
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "100", "name": "test"}).SignedString([]byte("test"))
+	badToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "100", "name": "test"}).SignedString([]byte("xyz"))
+
+	tests := []struct {
+		name   string
+		header string
+		wantID string
+	}{
+		{"no token", "", ""},
+		{"not bearer", "Basic abc", ""},
+		{"invalid token", "Bearer " + badToken, ""},
+		{"valid token", "Bearer " + token, "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			req.Header.Set("Authorization", tt.header)
+			ctx, res := test.MockRoutingContext(req)
+			assert.Nil(t, h(ctx))
+			assert.Empty(t, res.Header().Get("WWW-Authenticate"))
+			identity := CurrentUser(ctx.Request.Context())
+			if tt.wantID == "" {
+				assert.Nil(t, identity)
+			} else if assert.NotNil(t, identity) {
+				assert.Equal(t, tt.wantID, identity.GetID())
+				assert.Equal(t, "test", identity.GetName())
+			}
+		})
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		wantOK bool
+	}{
+		{"no token", "secret", "", false},
+		{"not bearer", "secret", "Basic secret", false},
+		{"wrong token", "secret", "Bearer secret2", false},
+		{"valid token", "secret", "Bearer secret", true},
+		{"token not configured", "", "Bearer ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			req.Header.Set("Authorization", tt.header)
+			ctx, _ := test.MockRoutingContext(req)
+			err := TokenHandler(tt.token)(ctx)
+			if tt.wantOK {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
 func Test_handleToken(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", nil)
 	ctx, _ := test.MockRoutingContext(req)
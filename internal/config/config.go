@@ -1,44 +1,459 @@
 package config
 
 import (
+	"errors"
 	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-env"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort                = 8080
+	defaultAdminPort                 = 9090
+	defaultJWTExpirationHours        = 72
+	defaultStreamHeartbeatSeconds    = 15
+	defaultIdempotencyTTLHours       = 24
+	defaultIdempotencyLockSeconds    = 300
+	defaultStorage                   = "database"
+	defaultIdempotencyStore          = "memory"
+	defaultRateLimitStore            = "memory"
+	defaultErrorFormat               = "problem"
+	defaultLocalesDir                = "./locales"
+	defaultRequestTimeoutSeconds     = 30
+	defaultTraceExporter             = "off"
+	defaultHealthcheckTimeoutSeconds = 3
+	defaultShutdownDrainSeconds      = 5
+	defaultReplicaMaxLagSeconds      = 10
+	defaultReplicaCheckSeconds       = 5
+	defaultCacheStore                = "off"
+	defaultCacheTTLSeconds           = 60
+	defaultCacheSize                 = 10000
+	defaultDBDriver                  = "postgres"
+	defaultDBMaxOpenConns            = 25
+	defaultDBMaxIdleConns            = 10
+	defaultDBConnMaxLifetimeSeconds  = 1800
+	defaultDBConnMaxIdleTimeSeconds  = 300
+	defaultDBConnectTimeoutSeconds   = 30
+	defaultDBStatementTimeoutMillis  = 30000
+	defaultDBLockTimeoutMillis       = 10000
 )
 
 // Config represents an application configuration.
 type Config struct {
+	// the environment the server runs in, such as "local", "dev", "qa" or "prod".
+	Env string `yaml:"env" env:"ENV"`
+	// whether to expose the causes and stack traces of server errors in the error responses.
+	// It can only be enabled when the environment is set and is not "prod".
+	Debug bool `yaml:"debug" env:"DEBUG"`
 	// the server port. Defaults to 8080
 	ServerPort int `yaml:"server_port" env:"SERVER_PORT"`
-	// the data source name (DSN) for connecting to the database. required.
+	// the port of the admin server which exposes the metrics at /metrics. Zero disables the admin server. Defaults to 9090
+	AdminPort int `yaml:"admin_port" env:"ADMIN_PORT"`
+	// the bearer token required by the admin endpoints under /admin, such as /admin/log-level.
+	// The endpoints are disabled if not set.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN,secret"`
+	// the logging configuration
+	Log Log `yaml:"log" env:"LOG"`
+	// the access log configuration
+	AccessLog AccessLog `yaml:"access_log" env:"ACCESS_LOG"`
+	// the configuration of capturing request and response bodies for debugging
+	BodyCapture BodyCapture `yaml:"body_capture" env:"BODY_CAPTURE"`
+	// where the application data is kept: "database" or "memory". The memory storage needs no database and loses
+	// the data when the server stops, which is meant for demos and frontend development. Defaults to "database"
+	Storage string `yaml:"storage" env:"STORAGE"`
+	// the data source name (DSN) for connecting to the database. required unless the storage is "memory".
 	DSN string `yaml:"dsn" env:"DSN,secret"`
+	// the connection pool and session settings of the database and its replicas
+	DB DB `yaml:"db" env:"DB"`
+	// the DSNs of the read replicas of the database, which serve the read-only queries of API requests.
+	// The environment variable takes a JSON array.
+	ReplicaDSNs []string `yaml:"replica_dsns" env:"REPLICA_DSNS,secret"`
+	// the seconds a replica may lag behind the primary database before it stops serving queries. Defaults to 10 seconds
+	ReplicaMaxLag int `yaml:"replica_max_lag" env:"REPLICA_MAX_LAG"`
+	// the interval in seconds of checking the replication lag of the replicas. Defaults to 5 seconds
+	ReplicaCheckInterval int `yaml:"replica_check_interval" env:"REPLICA_CHECK_INTERVAL"`
+	// the caching of album reads
+	Cache Cache `yaml:"cache" env:"CACHE"`
+	// the URL of the Redis server used by the cache, such as "redis://:password@localhost:6379/0".
+	// required if the cache store is "redis".
+	RedisURL string `yaml:"redis_url" env:"REDIS_URL,secret"`
 	// JWT signing key. required.
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
 	// JWT expiration in hours. Defaults to 72 hours (3 days)
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// the interval in seconds of the heartbeats sent by the album change feed. Defaults to 15 seconds
+	StreamHeartbeat int `yaml:"stream_heartbeat" env:"STREAM_HEARTBEAT"`
+	// the hours for which the responses of requests with idempotency keys are kept. Defaults to 24 hours
+	IdempotencyTTL int `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+	// the seconds after which a request with an idempotency key that is still in progress is considered abandoned,
+	// so that a retry can take over its key. It should be longer than any request takes. Defaults to 300 seconds
+	IdempotencyLockTimeout int `yaml:"idempotency_lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`
+	// where the responses of requests with idempotency keys are kept: "memory" or "postgres". Defaults to "memory".
+	// Use "postgres" when running multiple server instances.
+	IdempotencyStore string `yaml:"idempotency_store" env:"IDEMPOTENCY_STORE"`
+	// the rate limit applied to the requests of each client. No limit is applied by default
+	RateLimit RateLimit `yaml:"rate_limit" env:"RATE_LIMIT"`
+	// the rate limits of specific routes, keyed by route patterns such as "POST /v1/albums"
+	RateLimitRoutes map[string]RateLimit `yaml:"rate_limit_routes" env:"RATE_LIMIT_ROUTES"`
+	// where the rate limit states are kept: "memory" or "postgres". Defaults to "memory".
+	// Use "postgres" when running multiple server instances.
+	RateLimitStore string `yaml:"rate_limit_store" env:"RATE_LIMIT_STORE"`
+	// the format of the error responses: "problem" (RFC 7807) or "legacy". Defaults to "problem".
+	// Clients can ask for either format via the Accept header.
+	ErrorFormat string `yaml:"error_format" env:"ERROR_FORMAT"`
+	// the base URI of the problem types in the error responses. The problem types are "about:blank" if not set.
+	ErrorTypeBaseURI string `yaml:"error_type_base_uri" env:"ERROR_TYPE_BASE_URI"`
+	// the directory containing the message catalogs used to translate the error messages. Defaults to "./locales"
+	LocalesDir string `yaml:"locales_dir" env:"LOCALES_DIR"`
+	// the seconds allowed for processing a request. Zero means no timeout. Defaults to 30 seconds
+	RequestTimeout int `yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+	// the request timeouts in seconds of specific routes, keyed by route patterns such as "POST /v1/albums".
+	// The album change feed (GET /v1/albums/stream) has no timeout unless configured here.
+	RequestTimeoutRoutes map[string]int `yaml:"request_timeout_routes" env:"REQUEST_TIMEOUT_ROUTES"`
+	// where the traces of requests and DB operations are exported: "otlp", "stdout" or "off". Defaults to "off".
+	// The OTLP exporter is configured via the standard OTEL_EXPORTER_OTLP_* environment variables.
+	TraceExporter string `yaml:"trace_exporter" env:"TRACE_EXPORTER"`
+	// the seconds allowed for each check of the readiness and liveness probes (/readyz and /livez). Defaults to 3 seconds
+	HealthcheckTimeout int `yaml:"healthcheck_timeout" env:"HEALTHCHECK_TIMEOUT"`
+	// the seconds for which the server keeps serving requests while reporting not ready after receiving a shutdown
+	// signal, so that load balancers stop sending it new requests first. Defaults to 5 seconds
+	ShutdownDrain int `yaml:"shutdown_drain" env:"SHUTDOWN_DRAIN"`
+}
+
+// IsProd returns whether the environment is the production environment.
+func (c Config) IsProd() bool {
+	env := strings.ToLower(c.Env)
+	return env == "prod" || env == "production"
+}
+
+// Features returns whether each of the optional features of the server is enabled, keyed by the feature names.
+func (c Config) Features() map[string]bool {
+	return map[string]bool{
+		"memory_storage": c.Storage == "memory",
+		"read_replicas":  len(c.ReplicaDSNs) > 0,
+		"cache":          c.Cache.Store != "" && c.Cache.Store != "off",
+		"rate_limit":     c.RateLimit.Requests > 0 || len(c.RateLimitRoutes) > 0,
+		"tracing":        c.TraceExporter != "" && c.TraceExporter != "off",
+		"body_capture":   len(c.BodyCapture.Routes) > 0 || c.AdminToken != "",
+		"admin_api":      c.AdminToken != "",
+		"debug":          c.Debug && c.Env != "" && !c.IsProd(),
+	}
+}
+
+// Public returns the configuration keyed by the YAML names of the fields, without the secret fields
+// (those whose env tags contain "secret"), so that it can be exposed to the administrators.
+func (c Config) Public() map[string]interface{} {
+	return public(reflect.ValueOf(c)).(map[string]interface{})
+}
+
+// public converts a configuration value into plain maps, slices and values, omitting the secret fields of structs.
+func public(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		result := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if strings.Contains(field.Tag.Get("env"), ",secret") {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			result[name] = public(v.Field(i))
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			result[key.String()] = public(v.MapIndex(key))
+		}
+		return result
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			result[i] = public(v.Index(i))
+		}
+		return result
+	}
+	return v.Interface()
+}
+
+// RateLimit represents the number of requests a client is allowed to make in a period of time.
+type RateLimit struct {
+	// the number of requests allowed in each period. Zero means no limit
+	Requests int `yaml:"requests"`
+	// the length of the period in seconds. Defaults to 60 seconds
+	Period int `yaml:"period"`
+	// the maximum number of requests allowed at once. Defaults to the number of requests
+	Burst int `yaml:"burst"`
+}
+
+// Log represents the logging configuration.
+type Log struct {
+	// the minimum level of the log messages: "debug", "info", "warn" or "error". Defaults to "info"
+	Level string `yaml:"level"`
+	// the format of the log messages: "json" or "console". Defaults to "json"
+	Encoding string `yaml:"encoding"`
+	// the files or URLs the log messages are written to, such as "stdout" or "/var/log/app/server.log". Defaults to "stderr"
+	Outputs []string `yaml:"outputs"`
+	// the minimum levels of specific packages, such as {album: debug}, overriding the level of the server
+	Packages map[string]string `yaml:"packages"`
+	// the names of the log fields whose values are redacted, in addition to the defaults such as "password" and "email"
+	RedactFields []string `yaml:"redact_fields"`
+	// the regular expressions matching the text to be redacted from the log messages, in addition to the defaults
+	// matching emails, tokens, passwords and DSN credentials. Only the capturing groups are redacted if any.
+	RedactPatterns []string `yaml:"redact_patterns"`
+}
+
+// Validate validates the logging configuration.
+func (l Log) Validate() error {
+	levels := []interface{}{"debug", "info", "warn", "error"}
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.Level, validation.In(levels...)),
+		validation.Field(&l.Encoding, validation.In("json", "console")),
+		validation.Field(&l.Packages, validation.Each(validation.Required, validation.In(levels...))),
+		validation.Field(&l.RedactPatterns, validation.Each(validation.By(validateRegexp))),
+	)
+}
+
+// AccessLog represents the access log configuration.
+type AccessLog struct {
+	// the format of the access log messages: "default", "combined" (Apache/NCSA) or "json". Defaults to "default"
+	Format string `yaml:"format"`
+	// the IP addresses or CIDR ranges of the proxies whose X-Forwarded-For headers are trusted
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// the fraction of the successful requests that are logged. Failed and slow requests are always logged. Defaults to 1
+	SampleRate float64 `yaml:"sample_rate"`
+	// the route patterns of the requests that are not logged, such as "/healthcheck"
+	Exclude []string `yaml:"exclude"`
+	// the milliseconds above which requests are logged at WARN level with their details. Zero means never
+	SlowThreshold int `yaml:"slow_threshold"`
+}
+
+// Validate validates the access log configuration.
+func (a AccessLog) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Format, validation.In("default", "combined", "json")),
+		validation.Field(&a.TrustedProxies, validation.Each(validation.By(validateProxy))),
+		validation.Field(&a.SampleRate, validation.Min(0.0), validation.Max(1.0)),
+		validation.Field(&a.Exclude, validation.Each(validation.By(validateRoute))),
+		validation.Field(&a.SlowThreshold, validation.Min(0)),
+	)
+}
+
+// DB represents the connection pool and session settings of the database.
+type DB struct {
+	// the database driver: "postgres" or "sqlite3". SQLite databases, such as "file:app.db" or ":memory:",
+	// only support a single server instance. Defaults to "postgres"
+	Driver string `yaml:"driver"`
+	// the maximum number of open connections. Zero means no limit. Defaults to 25
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// the maximum number of idle connections kept in the pool. Zero keeps the default of database/sql (2). Defaults to 10
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// the seconds a connection may be reused. Zero means forever. Defaults to 1800 seconds
+	ConnMaxLifetime int `yaml:"conn_max_lifetime"`
+	// the seconds a connection may be idle before it is closed. Zero means forever. Defaults to 300 seconds
+	ConnMaxIdleTime int `yaml:"conn_max_idle_time"`
+	// the seconds allowed for connecting to the database at startup, during which failed attempts are retried.
+	// Defaults to 30 seconds
+	ConnectTimeout int `yaml:"connect_timeout"`
+	// the default statement_timeout of the sessions in milliseconds. Zero means no timeout. Defaults to 30000
+	StatementTimeout int `yaml:"statement_timeout"`
+	// the default lock_timeout of the sessions in milliseconds. Zero means no timeout. Defaults to 10000
+	LockTimeout int `yaml:"lock_timeout"`
+}
+
+// Validate validates the database settings.
+func (d DB) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Driver, validation.In("postgres", "sqlite3")),
+		validation.Field(&d.MaxOpenConns, validation.Min(0)),
+		validation.Field(&d.MaxIdleConns, validation.Min(0)),
+		validation.Field(&d.ConnMaxLifetime, validation.Min(0)),
+		validation.Field(&d.ConnMaxIdleTime, validation.Min(0)),
+		validation.Field(&d.ConnectTimeout, validation.Min(0)),
+		validation.Field(&d.StatementTimeout, validation.Min(0)),
+		validation.Field(&d.LockTimeout, validation.Min(0)),
+	)
+}
+
+// Cache represents the configuration of caching album reads.
+type Cache struct {
+	// where the albums are cached: "off", "memory" or "redis". Each server instance has its own memory cache,
+	// which learns about the changes made by the other instances from the album events. Defaults to "off"
+	Store string `yaml:"store"`
+	// the seconds for which an album is cached. It also bounds how long the redis store may serve an album
+	// cached by an instance that read it just before another instance changed it. Defaults to 60 seconds
+	TTL int `yaml:"ttl"`
+	// the maximum number of albums kept in the memory cache. Defaults to 10000
+	Size int `yaml:"size"`
+}
+
+// Validate validates the cache configuration.
+func (c Cache) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Store, validation.In("off", "memory", "redis")),
+		validation.Field(&c.TTL, validation.Min(1)),
+		validation.Field(&c.Size, validation.Min(1)),
+	)
+}
+
+// BodyCapture represents the configuration of capturing request and response bodies for debugging.
+type BodyCapture struct {
+	// the route patterns of the requests whose bodies are always captured, such as "POST /v1/albums".
+	// Other requests are captured if they carry the X-Debug-Capture header with the admin token.
+	Routes []string `yaml:"routes"`
+	// the maximum number of bytes captured from each body. Defaults to 4096
+	MaxSize int `yaml:"max_size"`
+	// the file the captured bodies are written to. The bodies are added to the access log messages if not set
+	File string `yaml:"file"`
+	// the megabytes above which the file is rotated. Defaults to 100
+	FileMaxSize int `yaml:"file_max_size"`
+	// the number of rotated files to keep. Zero keeps all of them
+	FileMaxBackups int `yaml:"file_max_backups"`
+}
+
+// Validate validates the body capture configuration.
+func (b BodyCapture) Validate() error {
+	return validation.ValidateStruct(&b,
+		validation.Field(&b.Routes, validation.Each(validation.By(validateRoute))),
+		validation.Field(&b.MaxSize, validation.Min(0)),
+		validation.Field(&b.FileMaxSize, validation.Min(0)),
+		validation.Field(&b.FileMaxBackups, validation.Min(0)),
+	)
+}
+
+// Validate validates the rate limit.
+func (r RateLimit) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Requests, validation.Min(0)),
+		validation.Field(&r.Period, validation.Min(0)),
+		validation.Field(&r.Burst, validation.Min(0)),
+	)
 }
 
 // Validate validates the application configuration.
 func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
-		validation.Field(&c.DSN, validation.Required),
+		validation.Field(&c.Env, validation.When(c.Debug, validation.Required.Error("must be set when debug is enabled"))),
+		validation.Field(&c.Debug, validation.When(c.IsProd(), validation.In(false).Error("must be disabled in prod"))),
+		validation.Field(&c.AdminPort, validation.Min(0), validation.When(c.AdminPort != 0, validation.NotIn(c.ServerPort).Error("must be different from the server port"))),
+		validation.Field(&c.Log),
+		validation.Field(&c.AccessLog),
+		validation.Field(&c.BodyCapture),
+		validation.Field(&c.Storage, validation.In("database", "memory")),
+		validation.Field(&c.DSN, validation.When(c.Storage != "memory", validation.Required)),
+		validation.Field(&c.DB),
+		validation.Field(&c.ReplicaDSNs, validation.Each(validation.Required),
+			validation.When(c.DB.Driver == "sqlite3", validation.Length(0, 0).Error("are only supported by postgres"))),
+		validation.Field(&c.ReplicaMaxLag, validation.Min(0)),
+		validation.Field(&c.ReplicaCheckInterval, validation.Min(1)),
+		validation.Field(&c.Cache),
+		validation.Field(&c.RedisURL, validation.When(c.Cache.Store == "redis", validation.Required)),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.StreamHeartbeat, validation.Min(1)),
+		validation.Field(&c.IdempotencyTTL, validation.Min(1)),
+		validation.Field(&c.IdempotencyLockTimeout, validation.Min(1)),
+		validation.Field(&c.IdempotencyStore, validation.In("memory", "postgres"),
+			validation.When(c.Storage == "memory", validation.In("memory").Error("must be memory when the storage is memory"))),
+		validation.Field(&c.RateLimit),
+		validation.Field(&c.RateLimitRoutes, validation.By(validateRoutes)),
+		validation.Field(&c.RateLimitStore, validation.In("memory", "postgres"),
+			validation.When(c.Storage == "memory", validation.In("memory").Error("must be memory when the storage is memory"))),
+		validation.Field(&c.ErrorFormat, validation.In("problem", "legacy")),
+		validation.Field(&c.LocalesDir, validation.Required),
+		validation.Field(&c.RequestTimeout, validation.Min(0)),
+		validation.Field(&c.RequestTimeoutRoutes, validation.By(validateRoutes)),
+		validation.Field(&c.TraceExporter, validation.In("otlp", "stdout", "off")),
+		validation.Field(&c.HealthcheckTimeout, validation.Min(1)),
+		validation.Field(&c.ShutdownDrain, validation.Min(0)),
 	)
 }
 
+// validateRegexp checks if a string is a valid regular expression.
+func validateRegexp(value interface{}) error {
+	_, err := regexp.Compile(value.(string))
+	return err
+}
+
+// validateProxy checks if a string is a valid IP address or CIDR range.
+func validateProxy(value interface{}) error {
+	s := value.(string)
+	if net.ParseIP(s) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(s); err != nil {
+		return errors.New("must be a valid IP address or CIDR range")
+	}
+	return nil
+}
+
+// validateRoute checks if a string is a valid route pattern.
+func validateRoute(value interface{}) error {
+	_, err := routematch.New(value.(string))
+	return err
+}
+
+// validateRoutes checks if the keys of a map of route settings are valid route patterns.
+func validateRoutes(value interface{}) error {
+	var patterns []string
+	for _, key := range reflect.ValueOf(value).MapKeys() {
+		patterns = append(patterns, key.String())
+	}
+	_, err := routematch.New(patterns...)
+	return err
+}
+
 // Load returns an application configuration which is populated from the given configuration file and environment variables.
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:             defaultServerPort,
+		AdminPort:              defaultAdminPort,
+		JWTExpiration:          defaultJWTExpirationHours,
+		StreamHeartbeat:        defaultStreamHeartbeatSeconds,
+		IdempotencyTTL:         defaultIdempotencyTTLHours,
+		IdempotencyLockTimeout: defaultIdempotencyLockSeconds,
+		Storage:                defaultStorage,
+		IdempotencyStore:       defaultIdempotencyStore,
+		RateLimitStore:         defaultRateLimitStore,
+		ErrorFormat:            defaultErrorFormat,
+		LocalesDir:             defaultLocalesDir,
+		RequestTimeout:         defaultRequestTimeoutSeconds,
+		TraceExporter:          defaultTraceExporter,
+		HealthcheckTimeout:     defaultHealthcheckTimeoutSeconds,
+		ShutdownDrain:          defaultShutdownDrainSeconds,
+		ReplicaMaxLag:          defaultReplicaMaxLagSeconds,
+		ReplicaCheckInterval:   defaultReplicaCheckSeconds,
+		Cache: Cache{
+			Store: defaultCacheStore,
+			TTL:   defaultCacheTTLSeconds,
+			Size:  defaultCacheSize,
+		},
+		DB: DB{
+			Driver:           defaultDBDriver,
+			MaxOpenConns:     defaultDBMaxOpenConns,
+			MaxIdleConns:     defaultDBMaxIdleConns,
+			ConnMaxLifetime:  defaultDBConnMaxLifetimeSeconds,
+			ConnMaxIdleTime:  defaultDBConnMaxIdleTimeSeconds,
+			ConnectTimeout:   defaultDBConnectTimeoutSeconds,
+			StatementTimeout: defaultDBStatementTimeoutMillis,
+			LockTimeout:      defaultDBLockTimeoutMillis,
+		},
 	}
 
 	// load from YAML config file
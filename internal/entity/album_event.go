@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// AlbumCreated is the type of the event recorded when an album is created.
+	AlbumCreated = "created"
+	// AlbumUpdated is the type of the event recorded when an album is updated.
+	AlbumUpdated = "updated"
+	// AlbumDeleted is the type of the event recorded when an album is deleted.
+	AlbumDeleted = "deleted"
+)
+
+// AlbumEvent represents a change made to an album.
+type AlbumEvent struct {
+	// Seq is the position of the event in the album change feed. It increases monotonically.
+	Seq int64 `json:"seq"`
+	// Type is the type of the change (AlbumCreated, AlbumUpdated or AlbumDeleted).
+	Type string `json:"type"`
+	// AlbumID is the ID of the album that was changed.
+	AlbumID string `json:"album_id"`
+	// UserID is the ID of the user who made the change. It is empty if the change was not made by a user.
+	UserID string `json:"user_id,omitempty"`
+	// Album is the album data after the change, or before the change if the album was deleted.
+	Album     Album     `json:"album"`
+	CreatedAt time.Time `json:"created_at"`
+}
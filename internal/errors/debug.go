@@ -0,0 +1,67 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type contextKey int
+
+const traceKey contextKey = iota
+
+// trace collects the information about a failing request that is exposed in debug mode.
+type trace struct {
+	mu    sync.Mutex
+	sql   string
+	stack string
+}
+
+// debugDetails represents the details of an error response in debug mode.
+type debugDetails struct {
+	// Errors lists the messages of the error and the errors it wraps, outermost first.
+	Errors []string `json:"errors"`
+	// Stack is the stack trace of the panic that caused the error, if any.
+	Stack string `json:"stack,omitempty"`
+	// SQL is the last SQL statement that failed while processing the request, if any.
+	SQL string `json:"sql,omitempty"`
+	// Details contains the original details of the error response.
+	Details interface{} `json:"details,omitempty"`
+}
+
+// withTrace returns a context that collects the debugging information about the request.
+func withTrace(ctx context.Context) (context.Context, *trace) {
+	t := &trace{}
+	return context.WithValue(ctx, traceKey, t), t
+}
+
+// RecordSQL records a failed SQL statement so that it can be exposed in the error response in debug mode.
+// It does nothing if the context does not belong to a request processed in debug mode.
+func RecordSQL(ctx context.Context, sql string) {
+	if ctx == nil {
+		return
+	}
+	if t, ok := ctx.Value(traceKey).(*trace); ok {
+		t.mu.Lock()
+		t.sql = sql
+		t.mu.Unlock()
+	}
+}
+
+// setStack records the stack trace of a panic.
+func (t *trace) setStack(stack []byte) {
+	t.mu.Lock()
+	t.stack = string(stack)
+	t.mu.Unlock()
+}
+
+// details builds the debugging details for the given error.
+func (t *trace) details(err error, details interface{}) debugDetails {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := debugDetails{Stack: t.stack, SQL: t.sql, Details: details}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		d.Errors = append(d.Errors, e.Error())
+	}
+	return d
+}
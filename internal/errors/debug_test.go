@@ -0,0 +1,33 @@
+package errors
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecordSQL(t *testing.T) {
+	// no trace in the context
+	RecordSQL(context.Background(), "SELECT 1")
+	RecordSQL(nil, "SELECT 1")
+
+	ctx, tr := withTrace(context.Background())
+	RecordSQL(ctx, "SELECT 1")
+	RecordSQL(ctx, "SELECT 2")
+	assert.Equal(t, "SELECT 2", tr.sql)
+}
+
+func Test_trace_details(t *testing.T) {
+	_, tr := withTrace(context.Background())
+	tr.setStack([]byte("stack"))
+	RecordSQL(context.WithValue(context.Background(), traceKey, tr), "SELECT 1")
+
+	err := fmt.Errorf("get album: %w", sql.ErrConnDone)
+	d := tr.details(err, "original")
+	assert.Equal(t, []string{"get album: sql: connection is already closed", "sql: connection is already closed"}, d.Errors)
+	assert.Equal(t, "stack", d.Stack)
+	assert.Equal(t, "SELECT 1", d.SQL)
+	assert.Equal(t, "original", d.Details)
+}
@@ -0,0 +1,111 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies the errors returned by the application logic so that they can be turned into HTTP responses.
+type Kind int
+
+const (
+	// KindInternal indicates an unexpected failure.
+	KindInternal Kind = iota
+	// KindNotFound indicates that the requested resource does not exist.
+	KindNotFound
+	// KindInvalid indicates that the request is invalid.
+	KindInvalid
+	// KindConflict indicates that the request conflicts with the current state of the resource.
+	KindConflict
+	// KindUnauthorized indicates that the user is not authenticated.
+	KindUnauthorized
+	// KindForbidden indicates that the user is not allowed to perform the requested action.
+	KindForbidden
+)
+
+// status returns the HTTP status code for the kind of errors.
+func (k Kind) status() int {
+	switch k {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// DomainError represents an error returned by the application logic, such as a service.
+// It carries the information needed to build an error response without depending on HTTP.
+type DomainError struct {
+	// Kind classifies the error.
+	Kind Kind
+	// Code is the machine-readable error code, such as "ALBUM_NOT_FOUND".
+	Code string
+	// Message is the human-readable error message.
+	Message string
+	// Field is the name of the field the error is about, if any. It is referenced by the translated message.
+	Field string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// NewDomainError creates a new DomainError.
+func NewDomainError(kind Kind, code, msg string, err error) *DomainError {
+	return &DomainError{Kind: kind, Code: code, Message: msg, Err: err}
+}
+
+// AlreadyExists creates a DomainError reporting that the value of the given field is already used by another resource,
+// such as a violation of a unique constraint. It is how every storage reports a duplicate, so that the API responds
+// the same regardless of the storage.
+func AlreadyExists(field string, err error) *DomainError {
+	return &DomainError{
+		Kind:    KindConflict,
+		Code:    CodeAlreadyExists,
+		Message: fmt.Sprintf("The %v is already in use.", field),
+		Field:   field,
+		Err:     err,
+	}
+}
+
+// Error is required by the error interface.
+func (e *DomainError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+// response builds the error response representing the error.
+func (e *DomainError) response() ErrorResponse {
+	status := e.Kind.status()
+	if status == http.StatusInternalServerError {
+		// hide the details of unexpected failures from the clients
+		res := InternalServerError("")
+		res.Code = e.Code
+		return res
+	}
+	res := ErrorResponse{
+		Status:     status,
+		Message:    e.Message,
+		Code:       e.Code,
+		MessageKey: e.Code,
+	}
+	if e.Field != "" {
+		res.MessageParams = map[string]interface{}{"field": e.Field}
+		if e.Code == CodeAlreadyExists {
+			res.Details = fieldDetails(e.Field, "validation_already_exists", "already exists")
+		}
+	}
+	return res
+}
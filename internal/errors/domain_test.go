@@ -0,0 +1,51 @@
+package errors
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestDomainError(t *testing.T) {
+	err := NewDomainError(KindNotFound, "ALBUM_NOT_FOUND", "The album was not found.", sql.ErrNoRows)
+	assert.Equal(t, "The album was not found.: sql: no rows in result set", err.Error())
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.Equal(t, ErrorResponse{
+		Status:     http.StatusNotFound,
+		Message:    "The album was not found.",
+		Code:       "ALBUM_NOT_FOUND",
+		MessageKey: "ALBUM_NOT_FOUND",
+	}, err.response())
+
+	err = NewDomainError(KindInternal, "STORAGE_FAILED", "disk full", nil)
+	assert.Equal(t, "disk full", err.Error())
+	res := err.response()
+	assert.Equal(t, http.StatusInternalServerError, res.Status)
+	assert.NotEqual(t, "disk full", res.Message)
+	assert.Equal(t, "STORAGE_FAILED", res.Code)
+}
+
+func TestAlreadyExists(t *testing.T) {
+	err := AlreadyExists("name", nil)
+	assert.Equal(t, KindConflict, err.Kind)
+	assert.Equal(t, CodeAlreadyExists, err.Code)
+	assert.Equal(t, ErrorResponse{
+		Status:        http.StatusConflict,
+		Message:       "The name is already in use.",
+		Details:       []invalidField{{Field: "name", Error: "already exists", code: "validation_already_exists"}},
+		Code:          CodeAlreadyExists,
+		MessageKey:    CodeAlreadyExists,
+		MessageParams: map[string]interface{}{"field": "name"},
+	}, err.response())
+}
+
+func TestKind_status(t *testing.T) {
+	assert.Equal(t, http.StatusInternalServerError, KindInternal.status())
+	assert.Equal(t, http.StatusNotFound, KindNotFound.status())
+	assert.Equal(t, http.StatusBadRequest, KindInvalid.status())
+	assert.Equal(t, http.StatusConflict, KindConflict.status())
+	assert.Equal(t, http.StatusUnauthorized, KindUnauthorized.status())
+	assert.Equal(t, http.StatusForbidden, KindForbidden.status())
+}
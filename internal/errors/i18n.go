@@ -0,0 +1,33 @@
+package errors
+
+import (
+	"github.com/qiangxue/go-rest-api/pkg/i18n"
+	"net/http"
+)
+
+// translate translates the message and the field errors of an error response into the language of the client.
+func (o Options) translate(req *http.Request, res ErrorResponse) ErrorResponse {
+	if o.Translator == nil {
+		return res
+	}
+	lang := i18n.Language(req.Context())
+	if lang == "" {
+		lang = o.Translator.Match(req.Header.Get("Accept-Language"))
+	}
+	if res.MessageKey != "" {
+		if msg, ok := o.Translator.Translate(lang, res.MessageKey, res.MessageParams); ok {
+			res.Message = msg
+		}
+	}
+	if fields, ok := res.Details.([]invalidField); ok {
+		translated := make([]invalidField, len(fields))
+		for i, field := range fields {
+			if msg, ok := o.Translator.Translate(lang, field.code, field.params); ok && field.code != "" {
+				field.Error = msg
+			}
+			translated[i] = field
+		}
+		res.Details = translated
+	}
+	return res
+}
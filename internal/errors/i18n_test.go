@@ -0,0 +1,90 @@
+package errors
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/pkg/i18n"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptions_translate(t *testing.T) {
+	translator := i18n.New(map[string]map[string]string{
+		"en": {"NOT_FOUND": "Not found.", "validation_length_out_of_range": "the length must be between {{.min}} and {{.max}}"},
+		"de": {"NOT_FOUND": "Nicht gefunden.", "VALIDATION_FAILED": "Ungültige Daten.", "validation_required": "darf nicht leer sein"},
+	})
+	options := Options{Translator: translator}
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de")
+
+	res := options.translate(req, NotFound(""))
+	assert.Equal(t, "Nicht gefunden.", res.Message)
+
+	// custom messages are not translated unless they have message keys
+	res = options.translate(req, NotFound("custom"))
+	assert.Equal(t, "custom", res.Message)
+	res = options.translate(req, NotFound("custom").WithMessageKey("NOT_FOUND", nil))
+	assert.Equal(t, "Nicht gefunden.", res.Message)
+
+	// the language in the context takes precedence over the Accept-Language header
+	res = options.translate(req.WithContext(i18n.WithLanguage(req.Context(), "en")), NotFound(""))
+	assert.Equal(t, "Not found.", res.Message)
+
+	// field errors are translated with English as the fallback
+	res = options.translate(req, InvalidInput(validation.Errors{
+		"name":  validation.ErrRequired,
+		"title": validation.ErrLengthOutOfRange.SetParams(map[string]interface{}{"min": 1, "max": 10}),
+		"other": validation.NewError("unknown", "custom error"),
+	}))
+	assert.Equal(t, "Ungültige Daten.", res.Message)
+	assert.Equal(t, []invalidField{
+		{Field: "name", Error: "darf nicht leer sein", code: "validation_required"},
+		{Field: "other", Error: "custom error", code: "unknown"},
+		{Field: "title", Error: "the length must be between 1 and 10", code: "validation_length_out_of_range", params: map[string]interface{}{"min": 1, "max": 10}},
+	}, res.Details)
+
+	// no translation without a translator
+	res = Options{}.translate(req, NotFound(""))
+	assert.Equal(t, NotFound("").Message, res.Message)
+}
+
+func TestHandler_translate(t *testing.T) {
+	logger, _ := log.NewForTest()
+	translator := i18n.New(map[string]map[string]string{"de": {"NOT_FOUND": "Nicht gefunden."}})
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	req.Header.Set("Accept-Language", "de-DE")
+	c := routing.NewContext(res, req, Handler(logger, Options{Translator: translator}), handlerHTTPError)
+	assert.Nil(t, c.Next())
+	assert.Contains(t, res.Body.String(), `"detail":"Nicht gefunden."`)
+}
+
+// TestLocales verifies that the message catalogs of the application are complete.
+func TestLocales(t *testing.T) {
+	translator, err := i18n.Load("../../locales")
+	if !assert.Nil(t, err) {
+		return
+	}
+	codes := []string{
+		CodeInternalError, CodeNotFound, CodeUnauthorized, CodeForbidden, CodeBadRequest, CodeConflict,
+		CodeRequestEntityTooLarge, CodeUnprocessableEntity, CodeTooManyRequests, CodeServiceUnavailable, CodeGatewayTimeout, CodeClientClosedRequest,
+		CodeValidationFailed, CodeAlreadyExists, CodeReferenceNotFound, CodeStillReferenced, CodeRetryable, CodeTimeout,
+		// the keys of the custom messages of other packages
+		"ALBUM_NOT_FOUND", "INVALID_LAST_EVENT_ID", "IDEMPOTENCY_KEY_REUSED", "IDEMPOTENCY_KEY_IN_PROGRESS", "RATE_LIMIT_EXCEEDED",
+	}
+	for _, lang := range []string{"en", "de"} {
+		for _, code := range codes {
+			msg, ok := translator.Translate(lang, code, nil)
+			assert.True(t, ok, lang+" "+code)
+			assert.NotEmpty(t, msg, lang+" "+code)
+		}
+	}
+	// the English messages are the same as the default ones
+	msg, _ := translator.Translate("en", CodeNotFound, nil)
+	assert.Equal(t, NotFound("").Message, msg)
+	msg, _ = translator.Translate("en", "validation_required", nil)
+	assert.Equal(t, validation.ErrRequired.Message(), msg)
+}
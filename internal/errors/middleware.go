@@ -1,19 +1,68 @@
 package errors
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/pkg/i18n"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"mime"
 	"net/http"
 	"runtime/debug"
+	"strings"
 )
 
+const (
+	// ProblemMediaType is the media type of the error responses in the problem details format (RFC 7807).
+	ProblemMediaType = "application/problem+json"
+	// LegacyMediaType is the media type a client can accept in order to get the error responses in the legacy format.
+	LegacyMediaType = "application/vnd.legacy-error+json"
+)
+
+// Options represents the options for rendering the error responses.
+type Options struct {
+	// Legacy indicates whether the error responses should be rendered in the legacy format, which only consists
+	// of the status, message and details. A client can still ask for either format via the Accept header.
+	Legacy bool
+	// TypeBaseURI is the base URI of the problem types. The type of a problem is the base URI followed by its
+	// error code in lower case, such as "https://example.com/problems/album_not_found".
+	// If empty, the type of every problem is "about:blank".
+	TypeBaseURI string
+	// Debug indicates whether the error chain, the panic stack trace and the failed SQL statement should be
+	// included in the details of server error responses. It must not be enabled in production.
+	Debug bool
+	// Translator translates the error messages into the language of the client, which is determined by
+	// i18n.Language() or else by the Accept-Language header. If nil, the messages are not translated.
+	Translator *i18n.Translator
+}
+
+// Problem is the response that represents an error in the problem details format (RFC 7807).
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
 // Handler creates a middleware that handles panics and errors encountered during HTTP request processing.
-func Handler(logger log.Logger) routing.Handler {
+// The error responses are rendered in the problem details format (RFC 7807) unless the options say otherwise.
+func Handler(logger log.Logger, options Options) routing.Handler {
 	return func(c *routing.Context) (err error) {
+		var t *trace
+		if options.Debug {
+			var ctx context.Context
+			ctx, t = withTrace(c.Request.Context())
+			c.Request = c.Request.WithContext(ctx)
+		}
+
 		defer func() {
 			l := logger.With(c.Request.Context())
 			if e := recover(); e != nil {
@@ -22,16 +71,40 @@ func Handler(logger log.Logger) routing.Handler {
 					err = fmt.Errorf("%v", e)
 				}
 
-				l.Errorf("recovered from panic (%v): %s", err, debug.Stack())
+				stack := debug.Stack()
+				l.Errorf("recovered from panic (%v): %s", err, stack)
+				if t != nil {
+					t.setStack(stack)
+				}
 			}
 
 			if err != nil {
-				res := buildErrorResponse(err)
-				if res.StatusCode() == http.StatusInternalServerError {
-					l.Errorf("encountered internal server error: %v", err)
+				if c.Request.Context().Err() == context.Canceled {
+					// the client has gone, so whatever error occurred is caused by the cancellation
+					err = fmt.Errorf("%v: %w", err, context.Canceled)
+				}
+				res := options.translate(c.Request, buildErrorResponse(err))
+				if res.StatusCode() == StatusClientClosedRequest {
+					l.Infof("request canceled by the client: %v", err)
 				}
-				c.Response.WriteHeader(res.StatusCode())
-				if err = c.Write(res); err != nil {
+				if res.StatusCode() >= http.StatusInternalServerError {
+					l.Errorf("encountered server error: %v", err)
+					if t != nil {
+						res.Details = t.details(err, res.Details)
+					}
+				}
+				for name, values := range res.Header {
+					c.Response.Header()[name] = values
+				}
+				if options.legacy(c.Request) {
+					c.Response.WriteHeader(res.StatusCode())
+					err = c.Write(res)
+				} else {
+					c.Response.Header().Set("Content-Type", ProblemMediaType)
+					c.Response.WriteHeader(res.StatusCode())
+					err = json.NewEncoder(c.Response).Encode(options.problem(c.Request, res))
+				}
+				if err != nil {
 					l.Errorf("failed writing error response: %v", err)
 				}
 				c.Abort() // skip any pending handlers since an error has occurred
@@ -42,8 +115,75 @@ func Handler(logger log.Logger) routing.Handler {
 	}
 }
 
+// legacy checks if the error response to the given request should be rendered in the legacy format.
+func (o Options) legacy(req *http.Request) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(accept)
+		switch mediaType {
+		case ProblemMediaType:
+			return false
+		case LegacyMediaType:
+			return true
+		}
+	}
+	return o.Legacy
+}
+
+// problem builds the problem details from an error response.
+func (o Options) problem(req *http.Request, res ErrorResponse) Problem {
+	code := res.Code
+	if code == "" {
+		code = codeFromStatus(res.Status)
+	}
+	typ := "about:blank"
+	if o.TypeBaseURI != "" {
+		typ = strings.TrimSuffix(o.TypeBaseURI, "/") + "/" + strings.ToLower(code)
+	}
+	title := http.StatusText(res.Status)
+	if title == "" {
+		// use the error code for non-standard status codes, e.g. "Client Closed Request" for 499
+		title = strings.Title(strings.ToLower(strings.ReplaceAll(code, "_", " ")))
+	}
+	return Problem{
+		Type:     typ,
+		Title:    title,
+		Status:   res.Status,
+		Detail:   res.Message,
+		Instance: log.RequestID(req.Context()),
+		Code:     code,
+		Details:  res.Details,
+	}
+}
+
+// codeFromStatus derives an error code from an HTTP status code, such as "METHOD_NOT_ALLOWED" from 405.
+func codeFromStatus(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return CodeInternalError
+	}
+	return strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// Code returns the machine-readable code of the error response representing the given error, such as "ALREADY_EXISTS"
+// for a duplicate reported by any storage.
+func Code(err error) string {
+	return buildErrorResponse(err).Code
+}
+
 // buildErrorResponse builds an error response from an error.
 func buildErrorResponse(err error) ErrorResponse {
+	if errors.Is(err, context.Canceled) {
+		return ClientClosedRequest("")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return GatewayTimeout("")
+	}
+
+	var de *DomainError
+	if errors.As(err, &de) {
+		return de.response()
+	}
+
 	switch err.(type) {
 	case ErrorResponse:
 		return err.(ErrorResponse)
@@ -61,6 +201,16 @@ func buildErrorResponse(err error) ErrorResponse {
 		}
 	}
 
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		if res, ok := buildPQErrorResponse(pe); ok {
+			return res
+		}
+	}
+	if res, ok := buildSQLiteErrorResponse(err); ok {
+		return res
+	}
+
 	if errors.Is(err, sql.ErrNoRows) {
 		return NotFound("")
 	}
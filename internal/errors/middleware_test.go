@@ -1,12 +1,15 @@
 package errors
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,7 +18,7 @@ import (
 func TestHandler(t *testing.T) {
 	t.Run("normal processing", func(t *testing.T) {
 		logger, entries := log.NewForTest()
-		handler := Handler(logger)
+		handler := Handler(logger, Options{})
 		ctx, res := buildContext(handler, handlerOK)
 		assert.Nil(t, ctx.Next())
 		assert.Zero(t, entries.Len())
@@ -24,7 +27,7 @@ func TestHandler(t *testing.T) {
 
 	t.Run("error processing", func(t *testing.T) {
 		logger, entries := log.NewForTest()
-		handler := Handler(logger)
+		handler := Handler(logger, Options{})
 		ctx, res := buildContext(handler, handlerError)
 		assert.Nil(t, ctx.Next())
 		assert.Equal(t, 1, entries.Len())
@@ -33,7 +36,7 @@ func TestHandler(t *testing.T) {
 
 	t.Run("HTTP error processing", func(t *testing.T) {
 		logger, entries := log.NewForTest()
-		handler := Handler(logger)
+		handler := Handler(logger, Options{})
 		ctx, res := buildContext(handler, handlerHTTPError)
 		assert.Nil(t, ctx.Next())
 		assert.Equal(t, 0, entries.Len())
@@ -42,7 +45,7 @@ func TestHandler(t *testing.T) {
 
 	t.Run("panic processing", func(t *testing.T) {
 		logger, entries := log.NewForTest()
-		handler := Handler(logger)
+		handler := Handler(logger, Options{})
 		ctx, res := buildContext(handler, handlerPanic)
 		assert.Nil(t, ctx.Next())
 		assert.Equal(t, 2, entries.Len())
@@ -50,6 +53,111 @@ func TestHandler(t *testing.T) {
 	})
 }
 
+func TestHandler_canceled(t *testing.T) {
+	logger, entries := log.NewForTest()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	reqCtx, cancel := context.WithCancel(req.Context())
+	c := routing.NewContext(res, req.WithContext(reqCtx), Handler(logger, Options{}), func(c *routing.Context) error {
+		cancel()
+		// errors caused by the cancellation may not wrap context.Canceled, such as those from the DB driver
+		return fmt.Errorf("canceling statement due to user request")
+	})
+	assert.Nil(t, c.Next())
+	assert.Equal(t, StatusClientClosedRequest, res.Code)
+	assert.Contains(t, res.Body.String(), `"title":"Client Closed Request"`)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, zapcore.InfoLevel, entries.All()[0].Level)
+	}
+}
+
+func TestHandler_debug(t *testing.T) {
+	logger, _ := log.NewForTest()
+
+	t.Run("error", func(t *testing.T) {
+		ctx, res := buildContext(Handler(logger, Options{Debug: true}), func(c *routing.Context) error {
+			RecordSQL(c.Request.Context(), "SELECT * FROM album")
+			return fmt.Errorf("query album: %w", sql.ErrConnDone)
+		})
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+		assert.Contains(t, res.Body.String(), `"errors":["query album: sql: connection is already closed","sql: connection is already closed"]`)
+		assert.Contains(t, res.Body.String(), `"sql":"SELECT * FROM album"`)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		ctx, res := buildContext(Handler(logger, Options{Debug: true}), handlerPanic)
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+		assert.Contains(t, res.Body.String(), `"stack":"goroutine`)
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		ctx, res := buildContext(Handler(logger, Options{Debug: true}), handlerHTTPError)
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.NotContains(t, res.Body.String(), `"errors"`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx, res := buildContext(Handler(logger, Options{}), func(c *routing.Context) error {
+			RecordSQL(c.Request.Context(), "SELECT * FROM album")
+			return fmt.Errorf("query album: %w", sql.ErrConnDone)
+		})
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+		assert.NotContains(t, res.Body.String(), "SELECT")
+		assert.NotContains(t, res.Body.String(), "connection")
+	})
+}
+
+func TestHandler_format(t *testing.T) {
+	logger, _ := log.NewForTest()
+	tests := []struct {
+		name        string
+		options     Options
+		accept      string
+		wantType    string
+		wantContent string
+		wantBody    string
+	}{
+		{"problem", Options{}, "", ProblemMediaType,
+			`{"type":"about:blank","title":"Not Found","status":404,"detail":"The requested resource was not found.","instance":"abc","code":"NOT_FOUND"}`,
+			""},
+		{"problem with type URI", Options{TypeBaseURI: "https://example.com/problems/"}, "", ProblemMediaType,
+			`{"type":"https://example.com/problems/not_found","title":"Not Found","status":404,"detail":"The requested resource was not found.","instance":"abc","code":"NOT_FOUND"}`,
+			""},
+		{"legacy", Options{Legacy: true}, "", "application/json",
+			`{"status":404,"message":"The requested resource was not found."}`,
+			""},
+		{"legacy accepting problem", Options{Legacy: true}, "application/json, application/problem+json", ProblemMediaType, "", `"code":"NOT_FOUND"`},
+		{"problem accepting legacy", Options{}, LegacyMediaType + "; q=0.9", "application/json", "", `"message"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("X-Request-ID", "abc")
+			req = req.WithContext(log.WithRequest(req.Context(), req))
+			c := routing.NewContext(res, req, Handler(logger, tt.options), content.TypeNegotiator(content.JSON), handlerHTTPError)
+			assert.Nil(t, c.Next())
+			assert.Equal(t, http.StatusNotFound, res.Code)
+			assert.Equal(t, tt.wantType, res.Header().Get("Content-Type")[:len(tt.wantType)])
+			if tt.wantContent != "" {
+				assert.JSONEq(t, tt.wantContent, res.Body.String())
+			}
+			assert.Contains(t, res.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func Test_codeFromStatus(t *testing.T) {
+	assert.Equal(t, "METHOD_NOT_ALLOWED", codeFromStatus(http.StatusMethodNotAllowed))
+	assert.Equal(t, "IM_A_TEAPOT", codeFromStatus(http.StatusTeapot))
+	assert.Equal(t, CodeInternalError, codeFromStatus(999))
+}
+
 func Test_buildErrorResponse(t *testing.T) {
 	res := NotFound("")
 	assert.Equal(t, res, buildErrorResponse(res))
@@ -68,6 +176,22 @@ func Test_buildErrorResponse(t *testing.T) {
 
 	res = buildErrorResponse(fmt.Errorf("test"))
 	assert.Equal(t, http.StatusInternalServerError, res.Status)
+
+	res = buildErrorResponse(fmt.Errorf("query: %w", context.DeadlineExceeded))
+	assert.Equal(t, http.StatusGatewayTimeout, res.Status)
+
+	res = buildErrorResponse(fmt.Errorf("query: %w", context.Canceled))
+	assert.Equal(t, StatusClientClosedRequest, res.Status)
+
+	res = buildErrorResponse(fmt.Errorf("wrapped: %w", NewDomainError(KindNotFound, "ALBUM_NOT_FOUND", "test", nil)))
+	assert.Equal(t, http.StatusNotFound, res.Status)
+	assert.Equal(t, "ALBUM_NOT_FOUND", res.Code)
+}
+
+func TestCode(t *testing.T) {
+	assert.Equal(t, CodeAlreadyExists, Code(AlreadyExists("id", nil)))
+	assert.Equal(t, CodeNotFound, Code(sql.ErrNoRows))
+	assert.Equal(t, CodeInternalError, Code(fmt.Errorf("test")))
 }
 
 func buildContext(handlers ...routing.Handler) (*routing.Context, *httptest.ResponseRecorder) {
@@ -0,0 +1,104 @@
+package errors
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Error codes of the responses representing database constraint violations and transient database failures.
+const (
+	CodeAlreadyExists     = "ALREADY_EXISTS"
+	CodeReferenceNotFound = "REFERENCE_NOT_FOUND"
+	CodeStillReferenced   = "STILL_REFERENCED"
+	CodeRetryable         = "RETRYABLE"
+	CodeTimeout           = "TIMEOUT"
+)
+
+// retryAfterSeconds is the number of seconds suggested to the clients before retrying a transient failure.
+const retryAfterSeconds = "1"
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]string{}
+
+	// keyColumnsRegexp extracts the column names from the details of a key violation, such as "Key (name)=(abc) already exists."
+	keyColumnsRegexp = regexp.MustCompile(`^Key \((.+?)\)=`)
+)
+
+// RegisterConstraint registers the name of the field that is validated by the named database constraint.
+// The field name is used in the error responses reporting the violations of the constraint. It should be the
+// name known to the API clients, such as a JSON field name, rather than the name of a database column.
+// Packages usually register their constraints in their init functions.
+func RegisterConstraint(constraint, field string) {
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+	constraints[constraint] = field
+}
+
+// constraintField returns the name of the field that is involved in the given PostgreSQL error.
+func constraintField(e *pq.Error) string {
+	constraintsMu.RLock()
+	field, ok := constraints[e.Constraint]
+	constraintsMu.RUnlock()
+	if ok {
+		return field
+	}
+	if e.Column != "" {
+		return e.Column
+	}
+	if m := keyColumnsRegexp.FindStringSubmatch(e.Detail); m != nil {
+		return m[1]
+	}
+	return e.Constraint
+}
+
+// buildPQErrorResponse builds an error response from a PostgreSQL error.
+// False is returned if the error does not represent a failure that can be attributed to the request.
+func buildPQErrorResponse(e *pq.Error) (ErrorResponse, bool) {
+	var res ErrorResponse
+	switch e.Code {
+	case "23505": // unique_violation
+		return AlreadyExists(constraintField(e), e).response(), true
+	case "23503": // foreign_key_violation
+		field := constraintField(e)
+		if strings.Contains(e.Detail, "is still referenced") {
+			res = Conflict("The resource is still referenced by other resources.")
+			res.Code = CodeStillReferenced
+		} else {
+			res = UnprocessableEntity(fmt.Sprintf("The %v refers to a resource that does not exist.", field))
+			res.Code = CodeReferenceNotFound
+			res.Details = fieldDetails(field, "validation_reference_not_found", "does not exist")
+		}
+	case "23502": // not_null_violation
+		res = BadRequest("There is some problem with the data you submitted.")
+		res.Code = CodeValidationFailed
+		res.Details = fieldDetails(constraintField(e), "validation_required", "cannot be blank")
+	case "23514": // check_violation
+		res = BadRequest("There is some problem with the data you submitted.")
+		res.Code = CodeValidationFailed
+		res.Details = fieldDetails(constraintField(e), "validation_invalid", "is invalid")
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		res = ServiceUnavailable("The request conflicted with another request. Please try again.")
+		res.Code = CodeRetryable
+		res.Header = http.Header{"Retry-After": []string{retryAfterSeconds}}
+	case "57014": // query_canceled, usually caused by a statement timeout
+		res = GatewayTimeout("")
+		res.Code = CodeTimeout
+	default:
+		return res, false
+	}
+	res.MessageKey = res.Code
+	if details, ok := res.Details.([]invalidField); ok {
+		res.MessageParams = map[string]interface{}{"field": details[0].Field}
+	}
+	return res, true
+}
+
+// fieldDetails builds the details of an error response reporting a problem with a single field.
+func fieldDetails(field, code, msg string) []invalidField {
+	return []invalidField{{Field: field, Error: msg, code: code}}
+}
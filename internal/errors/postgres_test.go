@@ -0,0 +1,73 @@
+package errors
+
+import (
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterConstraint(t *testing.T) {
+	RegisterConstraint("test_name_key", "title")
+	assert.Equal(t, "title", constraintField(&pq.Error{Constraint: "test_name_key", Column: "name"}))
+	assert.Equal(t, "name", constraintField(&pq.Error{Constraint: "other_key", Column: "name"}))
+	assert.Equal(t, "name", constraintField(&pq.Error{Constraint: "other_key", Detail: "Key (name)=(abc) already exists."}))
+	assert.Equal(t, "other_key", constraintField(&pq.Error{Constraint: "other_key"}))
+}
+
+func Test_buildPQErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *pq.Error
+		wantOK     bool
+		wantStatus int
+		wantCode   string
+	}{
+		{"unique", &pq.Error{Code: "23505", Detail: "Key (name)=(abc) already exists."}, true, http.StatusConflict, CodeAlreadyExists},
+		{"missing reference", &pq.Error{Code: "23503", Detail: `Key (album_id)=(1) is not present in table "album".`}, true, http.StatusUnprocessableEntity, CodeReferenceNotFound},
+		{"still referenced", &pq.Error{Code: "23503", Detail: `Key (id)=(1) is still referenced from table "track".`}, true, http.StatusConflict, CodeStillReferenced},
+		{"not null", &pq.Error{Code: "23502", Column: "name"}, true, http.StatusBadRequest, CodeValidationFailed},
+		{"check", &pq.Error{Code: "23514", Constraint: "album_name_check"}, true, http.StatusBadRequest, CodeValidationFailed},
+		{"serialization", &pq.Error{Code: "40001"}, true, http.StatusServiceUnavailable, CodeRetryable},
+		{"deadlock", &pq.Error{Code: "40P01"}, true, http.StatusServiceUnavailable, CodeRetryable},
+		{"timeout", &pq.Error{Code: "57014"}, true, http.StatusGatewayTimeout, CodeTimeout},
+		{"other", &pq.Error{Code: "42P01"}, false, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := buildPQErrorResponse(tt.err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantStatus, res.Status)
+			assert.Equal(t, tt.wantCode, res.Code)
+		})
+	}
+
+	res, _ := buildPQErrorResponse(&pq.Error{Code: "23505", Detail: "Key (name)=(abc) already exists."})
+	assert.Equal(t, "The name is already in use.", res.Message)
+	assert.Equal(t, []invalidField{{Field: "name", Error: "already exists", code: "validation_already_exists"}}, res.Details)
+	assert.Equal(t, CodeAlreadyExists, res.MessageKey)
+	assert.Equal(t, map[string]interface{}{"field": "name"}, res.MessageParams)
+	res, _ = buildPQErrorResponse(&pq.Error{Code: "40001"})
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+}
+
+func Test_buildErrorResponse_pqError(t *testing.T) {
+	res := buildErrorResponse(fmt.Errorf("query failed: %w", &pq.Error{Code: "23505", Column: "name"}))
+	assert.Equal(t, http.StatusConflict, res.Status)
+	res = buildErrorResponse(&pq.Error{Code: "42P01"})
+	assert.Equal(t, http.StatusInternalServerError, res.Status)
+}
+
+func TestHandler_pqError(t *testing.T) {
+	logger, entries := log.NewForTest()
+	ctx, res := buildContext(Handler(logger, Options{}), func(c *routing.Context) error {
+		return &pq.Error{Code: "40P01"}
+	})
+	assert.Nil(t, ctx.Next())
+	assert.Equal(t, 1, entries.Len())
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "1", res.Header().Get("Retry-After"))
+}
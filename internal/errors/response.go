@@ -6,11 +6,42 @@ import (
 	"sort"
 )
 
+// Error codes identifying the general kinds of errors. Domain-specific codes, such as "ALBUM_NOT_FOUND",
+// are defined by the packages returning them.
+const (
+	CodeInternalError         = "INTERNAL_ERROR"
+	CodeNotFound              = "NOT_FOUND"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeForbidden             = "FORBIDDEN"
+	CodeBadRequest            = "BAD_REQUEST"
+	CodeConflict              = "CONFLICT"
+	CodeRequestEntityTooLarge = "REQUEST_ENTITY_TOO_LARGE"
+	CodeUnprocessableEntity   = "UNPROCESSABLE_ENTITY"
+	CodeTooManyRequests       = "TOO_MANY_REQUESTS"
+	CodeServiceUnavailable    = "SERVICE_UNAVAILABLE"
+	CodeGatewayTimeout        = "GATEWAY_TIMEOUT"
+	CodeClientClosedRequest   = "CLIENT_CLOSED_REQUEST"
+	CodeValidationFailed      = "VALIDATION_FAILED"
+)
+
+// StatusClientClosedRequest is the non-standard HTTP status code indicating that the client closed the connection
+// before the server finished processing the request.
+const StatusClientClosedRequest = 499
+
 // ErrorResponse is the response that represents an error.
 type ErrorResponse struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
 	Details interface{} `json:"details,omitempty"`
+	// Code is the machine-readable error code. It is only rendered in the problem details format.
+	Code string `json:"-"`
+	// Header contains the HTTP headers to be sent with the response, such as Retry-After.
+	Header http.Header `json:"-"`
+	// MessageKey identifies the message in the message catalogs so that it can be translated.
+	// The message is not translated if the key is empty.
+	MessageKey string `json:"-"`
+	// MessageParams contains the parameters referenced by the translated message.
+	MessageParams map[string]interface{} `json:"-"`
 }
 
 // Error is required by the error interface.
@@ -23,64 +54,200 @@ func (e ErrorResponse) StatusCode() int {
 	return e.Status
 }
 
+// WithMessageKey returns a copy of the error response whose custom message is identified by the given key
+// in the message catalogs, so that it can be translated. The parameters are referenced by the translated message.
+func (e ErrorResponse) WithMessageKey(key string, params map[string]interface{}) ErrorResponse {
+	e.MessageKey = key
+	e.MessageParams = params
+	return e
+}
+
 // InternalServerError creates a new error response representing an internal server error (HTTP 500)
 func InternalServerError(msg string) ErrorResponse {
+	key := ""
 	if msg == "" {
 		msg = "We encountered an error while processing your request."
+		key = CodeInternalError
 	}
 	return ErrorResponse{
-		Status:  http.StatusInternalServerError,
-		Message: msg,
+		Status:     http.StatusInternalServerError,
+		Message:    msg,
+		Code:       CodeInternalError,
+		MessageKey: key,
 	}
 }
 
 // NotFound creates a new error response representing a resource-not-found error (HTTP 404)
 func NotFound(msg string) ErrorResponse {
+	key := ""
 	if msg == "" {
 		msg = "The requested resource was not found."
+		key = CodeNotFound
 	}
 	return ErrorResponse{
-		Status:  http.StatusNotFound,
-		Message: msg,
+		Status:     http.StatusNotFound,
+		Message:    msg,
+		Code:       CodeNotFound,
+		MessageKey: key,
 	}
 }
 
 // Unauthorized creates a new error response representing an authentication/authorization failure (HTTP 401)
 func Unauthorized(msg string) ErrorResponse {
+	key := ""
 	if msg == "" {
 		msg = "You are not authenticated to perform the requested action."
+		key = CodeUnauthorized
 	}
 	return ErrorResponse{
-		Status:  http.StatusUnauthorized,
-		Message: msg,
+		Status:     http.StatusUnauthorized,
+		Message:    msg,
+		Code:       CodeUnauthorized,
+		MessageKey: key,
 	}
 }
 
 // Forbidden creates a new error response representing an authorization failure (HTTP 403)
 func Forbidden(msg string) ErrorResponse {
+	key := ""
 	if msg == "" {
 		msg = "You are not authorized to perform the requested action."
+		key = CodeForbidden
 	}
 	return ErrorResponse{
-		Status:  http.StatusForbidden,
-		Message: msg,
+		Status:     http.StatusForbidden,
+		Message:    msg,
+		Code:       CodeForbidden,
+		MessageKey: key,
 	}
 }
 
 // BadRequest creates a new error response representing a bad request (HTTP 400)
 func BadRequest(msg string) ErrorResponse {
+	key := ""
 	if msg == "" {
 		msg = "Your request is in a bad format."
+		key = CodeBadRequest
+	}
+	return ErrorResponse{
+		Status:     http.StatusBadRequest,
+		Message:    msg,
+		Code:       CodeBadRequest,
+		MessageKey: key,
+	}
+}
+
+// Conflict creates a new error response representing a conflict with the current state of the resource (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "The request conflicts with the current state of the resource."
+		key = CodeConflict
+	}
+	return ErrorResponse{
+		Status:     http.StatusConflict,
+		Message:    msg,
+		Code:       CodeConflict,
+		MessageKey: key,
+	}
+}
+
+// UnprocessableEntity creates a new error response representing a request that cannot be processed (HTTP 422)
+func UnprocessableEntity(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "Your request cannot be processed."
+		key = CodeUnprocessableEntity
+	}
+	return ErrorResponse{
+		Status:     http.StatusUnprocessableEntity,
+		Message:    msg,
+		Code:       CodeUnprocessableEntity,
+		MessageKey: key,
+	}
+}
+
+// RequestEntityTooLarge creates a new error response representing a request whose body is too large (HTTP 413)
+func RequestEntityTooLarge(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "Your request is too large."
+		key = CodeRequestEntityTooLarge
+	}
+	return ErrorResponse{
+		Status:     http.StatusRequestEntityTooLarge,
+		Message:    msg,
+		Code:       CodeRequestEntityTooLarge,
+		MessageKey: key,
+	}
+}
+
+// TooManyRequests creates a new error response representing a client exceeding its rate limit (HTTP 429)
+func TooManyRequests(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "You have made too many requests. Please try again later."
+		key = CodeTooManyRequests
+	}
+	return ErrorResponse{
+		Status:     http.StatusTooManyRequests,
+		Message:    msg,
+		Code:       CodeTooManyRequests,
+		MessageKey: key,
+	}
+}
+
+// ServiceUnavailable creates a new error response representing a temporary failure (HTTP 503)
+func ServiceUnavailable(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "The service is temporarily unavailable. Please try again later."
+		key = CodeServiceUnavailable
+	}
+	return ErrorResponse{
+		Status:     http.StatusServiceUnavailable,
+		Message:    msg,
+		Code:       CodeServiceUnavailable,
+		MessageKey: key,
+	}
+}
+
+// GatewayTimeout creates a new error response representing a request that took too long to process (HTTP 504)
+func GatewayTimeout(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "Your request took too long to process."
+		key = CodeGatewayTimeout
+	}
+	return ErrorResponse{
+		Status:     http.StatusGatewayTimeout,
+		Message:    msg,
+		Code:       CodeGatewayTimeout,
+		MessageKey: key,
+	}
+}
+
+// ClientClosedRequest creates a new error response representing a request canceled by the client (HTTP 499)
+func ClientClosedRequest(msg string) ErrorResponse {
+	key := ""
+	if msg == "" {
+		msg = "The request was canceled by the client."
+		key = CodeClientClosedRequest
 	}
 	return ErrorResponse{
-		Status:  http.StatusBadRequest,
-		Message: msg,
+		Status:     StatusClientClosedRequest,
+		Message:    msg,
+		Code:       CodeClientClosedRequest,
+		MessageKey: key,
 	}
 }
 
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
+	// code identifies the error message in the message catalogs, such as "validation_required".
+	code   string
+	params map[string]interface{}
 }
 
 // InvalidInput creates a new error response representing a data validation error (HTTP 400).
@@ -92,15 +259,21 @@ func InvalidInput(errs validation.Errors) ErrorResponse {
 	}
 	sort.Strings(fields)
 	for _, field := range fields {
-		details = append(details, invalidField{
+		f := invalidField{
 			Field: field,
 			Error: errs[field].Error(),
-		})
+		}
+		if e, ok := errs[field].(validation.Error); ok {
+			f.code, f.params = e.Code(), e.Params()
+		}
+		details = append(details, f)
 	}
 
 	return ErrorResponse{
-		Status:  http.StatusBadRequest,
-		Message: "There is some problem with the data you submitted.",
-		Details: details,
+		Status:     http.StatusBadRequest,
+		Message:    "There is some problem with the data you submitted.",
+		Details:    details,
+		Code:       CodeValidationFailed,
+		MessageKey: CodeValidationFailed,
 	}
 }
@@ -22,6 +22,13 @@ func TestErrorResponse_StatusCode(t *testing.T) {
 	assert.Equal(t, 400, e.StatusCode())
 }
 
+func TestErrorResponse_WithMessageKey(t *testing.T) {
+	res := BadRequest("test").WithMessageKey("TEST", map[string]interface{}{"n": 1})
+	assert.Equal(t, "test", res.Message)
+	assert.Equal(t, "TEST", res.MessageKey)
+	assert.Equal(t, map[string]interface{}{"n": 1}, res.MessageParams)
+}
+
 func TestInternalServerError(t *testing.T) {
 	res := InternalServerError("test")
 	assert.Equal(t, http.StatusInternalServerError, res.StatusCode())
@@ -62,11 +69,67 @@ func TestBadRequest(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestConflict(t *testing.T) {
+	res := Conflict("test")
+	assert.Equal(t, http.StatusConflict, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = Conflict("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestRequestEntityTooLarge(t *testing.T) {
+	res := RequestEntityTooLarge("test")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = RequestEntityTooLarge("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestUnprocessableEntity(t *testing.T) {
+	res := UnprocessableEntity("test")
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = UnprocessableEntity("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestTooManyRequests(t *testing.T) {
+	res := TooManyRequests("test")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = TooManyRequests("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	res := ServiceUnavailable("test")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = ServiceUnavailable("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestGatewayTimeout(t *testing.T) {
+	res := GatewayTimeout("test")
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = GatewayTimeout("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestClientClosedRequest(t *testing.T) {
+	res := ClientClosedRequest("test")
+	assert.Equal(t, StatusClientClosedRequest, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = ClientClosedRequest("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
 		"abc": fmt.Errorf("1"),
 	})
 	assert.Equal(t, http.StatusBadRequest, err.Status)
-	assert.Equal(t, []invalidField{{"abc", "1"}, {"xyz", "2"}}, err.Details)
+	assert.Equal(t, []invalidField{{Field: "abc", Error: "1"}, {Field: "xyz", Error: "2"}}, err.Details)
 }
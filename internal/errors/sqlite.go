@@ -0,0 +1,66 @@
+//go:build cgo
+
+package errors
+
+import (
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"net/http"
+	"strings"
+)
+
+// sqliteField returns the name of the field that is involved in the given SQLite constraint violation, whose message
+// names the failed columns, such as "UNIQUE constraint failed: album.id". The columns may be registered as constraints
+// in the "table.column" form via RegisterConstraint.
+func sqliteField(e sqlite3.Error) string {
+	msg := e.Error()
+	i := strings.LastIndex(msg, ": ")
+	if i < 0 {
+		return ""
+	}
+	column := strings.Split(msg[i+2:], ", ")[0]
+	constraintsMu.RLock()
+	field, ok := constraints[column]
+	constraintsMu.RUnlock()
+	if ok {
+		return field
+	}
+	return column[strings.LastIndex(column, ".")+1:]
+}
+
+// buildSQLiteErrorResponse builds an error response from an error wrapping a SQLite error, so that the API responds
+// the same as with PostgreSQL (see buildPQErrorResponse). The SQLite driver requires cgo, so the binaries built without
+// cgo use the stub in sqlite_nocgo.go instead.
+// False is returned if the error is not a SQLite error or does not represent a failure that can be attributed
+// to the request.
+func buildSQLiteErrorResponse(err error) (ErrorResponse, bool) {
+	var res ErrorResponse
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return res, false
+	}
+	switch e.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return AlreadyExists(sqliteField(e), e).response(), true
+	case sqlite3.ErrConstraintNotNull:
+		res = BadRequest("There is some problem with the data you submitted.")
+		res.Code = CodeValidationFailed
+		res.Details = fieldDetails(sqliteField(e), "validation_required", "cannot be blank")
+	case sqlite3.ErrConstraintCheck:
+		res = BadRequest("There is some problem with the data you submitted.")
+		res.Code = CodeValidationFailed
+		res.Details = fieldDetails(sqliteField(e), "validation_invalid", "is invalid")
+	default:
+		if e.Code != sqlite3.ErrBusy && e.Code != sqlite3.ErrLocked {
+			return res, false
+		}
+		res = ServiceUnavailable("The request conflicted with another request. Please try again.")
+		res.Code = CodeRetryable
+		res.Header = http.Header{"Retry-After": []string{retryAfterSeconds}}
+	}
+	res.MessageKey = res.Code
+	if details, ok := res.Details.([]invalidField); ok {
+		res.MessageParams = map[string]interface{}{"field": details[0].Field}
+	}
+	return res, true
+}
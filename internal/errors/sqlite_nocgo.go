@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package errors
+
+// buildSQLiteErrorResponse does nothing because the SQLite driver is unavailable without cgo.
+func buildSQLiteErrorResponse(err error) (ErrorResponse, bool) {
+	return ErrorResponse{}, false
+}
@@ -0,0 +1,65 @@
+//go:build cgo
+
+package errors
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_buildSQLiteErrorResponse(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE test (id TEXT PRIMARY KEY, name TEXT NOT NULL CHECK (name <> ''), title TEXT UNIQUE)")
+	assert.Nil(t, err)
+	_, err = db.Exec("INSERT INTO test (id, name, title) VALUES ('1', 'a', 'a')")
+	assert.Nil(t, err)
+	RegisterConstraint("test.title", "caption")
+
+	tests := []struct {
+		name       string
+		sql        string
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{"primary key", "INSERT INTO test (id, name) VALUES ('1', 'b')", http.StatusConflict, CodeAlreadyExists, "id"},
+		{"unique", "INSERT INTO test (id, name, title) VALUES ('2', 'b', 'a')", http.StatusConflict, CodeAlreadyExists, "caption"},
+		{"not null", "INSERT INTO test (id) VALUES ('2')", http.StatusBadRequest, CodeValidationFailed, "name"},
+		{"check", "INSERT INTO test (id, name) VALUES ('2', '')", http.StatusBadRequest, CodeValidationFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Exec(tt.sql)
+			if !assert.IsType(t, sqlite3.Error{}, err) {
+				return
+			}
+			res, ok := buildSQLiteErrorResponse(err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantStatus, res.Status)
+			assert.Equal(t, tt.wantCode, res.Code)
+			assert.Equal(t, tt.wantCode, res.MessageKey)
+			if tt.wantField != "" {
+				assert.Equal(t, tt.wantField, res.Details.([]invalidField)[0].Field)
+			}
+		})
+	}
+
+	_, err = db.Exec("SELECT * FROM missing")
+	_, ok := buildSQLiteErrorResponse(err)
+	assert.False(t, ok)
+	_, ok = buildSQLiteErrorResponse(fmt.Errorf("test"))
+	assert.False(t, ok)
+
+	// the errors are mapped regardless of the storage
+	_, err = db.Exec("INSERT INTO test (id, name) VALUES ('1', 'b')")
+	res := buildErrorResponse(fmt.Errorf("query failed: %w", err))
+	assert.Equal(t, AlreadyExists("id", nil).response(), res)
+}
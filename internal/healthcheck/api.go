@@ -1,10 +1,19 @@
 package healthcheck
 
-import routing "github.com/go-ozzo/ozzo-routing/v2"
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"net/http"
+)
 
 // RegisterHandlers registers the handlers that perform healthchecks.
-func RegisterHandlers(r *routing.Router, version string) {
+//
+// GET /livez and GET /readyz respond with the results of the liveness and readiness checks of the given checker,
+// with the status 503 if any check fails or the server is shutting down.
+func RegisterHandlers(r *routing.Router, version string, checker *Checker) {
 	r.To("GET,HEAD", "/healthcheck", healthcheck(version))
+	r.To("GET,HEAD", "/livez", probe(checker.Live))
+	r.To("GET,HEAD", "/readyz", probe(checker.Ready))
 }
 
 // healthcheck responds to a healthcheck request.
@@ -13,3 +22,14 @@ func healthcheck(version string) routing.Handler {
 		return c.Write("OK " + version)
 	}
 }
+
+// probe responds to a liveness or readiness probe with the result of the given checks.
+func probe(run func(ctx context.Context) Result) routing.Handler {
+	return func(c *routing.Context) error {
+		result := run(c.Request.Context())
+		if result.Status != StatusOK {
+			return c.WriteWithStatus(result, http.StatusServiceUnavailable)
+		}
+		return c.Write(result)
+	}
+}
@@ -1,6 +1,8 @@
 package healthcheck
 
 import (
+	"context"
+	"errors"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"net/http"
@@ -10,8 +12,30 @@ import (
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	RegisterHandlers(router, "0.9.0")
+	checker := NewChecker(0)
+	RegisterHandlers(router, "0.9.0", checker)
 	test.Endpoint(t, router, test.APITestCase{
 		"ok", "GET", "/healthcheck", "", nil, http.StatusOK, `"OK 0.9.0"`,
 	})
+	test.Endpoint(t, router, test.APITestCase{
+		"live", "GET", "/livez", "", nil, http.StatusOK, `{"status":"ok"}`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		"ready", "GET", "/readyz", "", nil, http.StatusOK, `{"status":"ok"}`,
+	})
+
+	checker.AddReadinessCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		"live with failed readiness check", "GET", "/livez", "", nil, http.StatusOK, `{"status":"ok"}`,
+	})
+	test.Endpoint(t, router, test.APITestCase{
+		"not ready", "GET", "/readyz", "", nil, http.StatusServiceUnavailable, `*"error":"connection refused"*`,
+	})
+
+	checker.Shutdown()
+	test.Endpoint(t, router, test.APITestCase{
+		"shutting down", "GET", "/readyz", "", nil, http.StatusServiceUnavailable, `{"status":"shutting down"}`,
+	})
 }
@@ -0,0 +1,153 @@
+package healthcheck
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// The statuses of the health checks.
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusShutdown = "shutting down"
+)
+
+// Check checks the health of the server or one of its dependencies. It returns an error if it is not healthy.
+// The check should give up when the context is done.
+type Check func(ctx context.Context) error
+
+// Checker is a registry of the health checks that determine whether the server is alive and ready to serve requests.
+type Checker struct {
+	mu        sync.RWMutex
+	timeout   time.Duration
+	liveness  []namedCheck
+	readiness []namedCheck
+	shutdown  bool
+}
+
+// namedCheck is a health check and its name.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Result represents the result of running the health checks.
+type Result struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult represents the result of a single health check.
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewChecker creates a new Checker which allows each check to take up to the given timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// AddLivenessCheck registers a check that must pass for the server to be considered alive.
+// A server that is not alive should be restarted, so the check should not depend on external services.
+func (c *Checker) AddLivenessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness = append(c.liveness, namedCheck{name, check})
+}
+
+// AddReadinessCheck registers a check that must pass for the server to be ready to serve requests,
+// such as a check of the database connection.
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness = append(c.readiness, namedCheck{name, check})
+}
+
+// Shutdown marks the server as not ready because it is shutting down, so that load balancers stop sending
+// new requests to it while the ongoing requests are completed.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shutdown = true
+}
+
+// Live runs the liveness checks.
+func (c *Checker) Live(ctx context.Context) Result {
+	c.mu.RLock()
+	checks := c.liveness
+	c.mu.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// Ready runs the liveness and readiness checks. The server is not ready once Shutdown is called.
+func (c *Checker) Ready(ctx context.Context) Result {
+	c.mu.RLock()
+	checks := append(append([]namedCheck(nil), c.liveness...), c.readiness...)
+	shutdown := c.shutdown
+	c.mu.RUnlock()
+	if shutdown {
+		return Result{Status: StatusShutdown}
+	}
+	return c.run(ctx, checks)
+}
+
+// run runs the given checks concurrently and collects their results.
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Result {
+	result := Result{Status: StatusOK, Checks: map[string]CheckResult{}}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			r := c.runCheck(ctx, nc.check)
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[nc.name] = r
+			if r.Status != StatusOK {
+				result.Status = StatusFailed
+			}
+		}(nc)
+	}
+	wg.Wait()
+	return result
+}
+
+// runCheck runs a single check within the timeout.
+func (c *Checker) runCheck(ctx context.Context, check Check) CheckResult {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := make(chan error, 1)
+	go func() {
+		err <- check(ctx)
+	}()
+	var e error
+	select {
+	case e = <-err:
+	case <-ctx.Done():
+		// do not wait for a check that ignores the context
+		e = ctx.Err()
+	}
+	r := CheckResult{Status: StatusOK, Latency: time.Since(start).String()}
+	if e != nil {
+		r.Status, r.Error = StatusFailed, e.Error()
+	}
+	return r
+}
+
+// DBCheck returns a check that pings the given database.
+func DBCheck(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
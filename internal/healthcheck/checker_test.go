@@ -0,0 +1,44 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.AddLivenessCheck("goroutines", func(ctx context.Context) error {
+		return nil
+	})
+	checker.AddReadinessCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	checker.AddReadinessCheck("cache", func(ctx context.Context) error {
+		// ignores the context
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	result := checker.Live(context.Background())
+	assert.Equal(t, StatusOK, result.Status)
+	assert.Len(t, result.Checks, 1)
+	assert.Equal(t, StatusOK, result.Checks["goroutines"].Status)
+	assert.NotEmpty(t, result.Checks["goroutines"].Latency)
+
+	start := time.Now()
+	result = checker.Ready(context.Background())
+	assert.True(t, time.Since(start) < time.Second, "the checks should time out")
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Len(t, result.Checks, 3)
+	assert.Equal(t, StatusOK, result.Checks["goroutines"].Status)
+	assert.Equal(t, CheckResult{Status: StatusFailed, Latency: result.Checks["db"].Latency, Error: "connection refused"}, result.Checks["db"])
+	assert.Equal(t, StatusFailed, result.Checks["cache"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), result.Checks["cache"].Error)
+
+	checker.Shutdown()
+	assert.Equal(t, Result{Status: StatusShutdown}, checker.Ready(context.Background()))
+	assert.Equal(t, StatusOK, checker.Live(context.Background()).Status)
+}
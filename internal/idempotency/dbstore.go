@@ -0,0 +1,135 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"sync"
+	"time"
+)
+
+// dbRecord is the database representation of a Record.
+type dbRecord struct {
+	Key         string `db:"pk"`
+	Fingerprint string
+	Completed   bool
+	Status      int
+	Header      string
+	Body        []byte
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+// TableName returns the name of the table storing the idempotency records.
+func (dbRecord) TableName() string {
+	return "idempotency_key"
+}
+
+// dbStore keeps the records in the database so that they are shared by all server instances.
+type dbStore struct {
+	db        *dbcontext.DB
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewDBStore creates a new store that keeps the records in the database.
+func NewDBStore(db *dbcontext.DB) Store {
+	return &dbStore{db: db, lastPurge: time.Now()}
+}
+
+// Start inserts the record unless an unexpired record with the same key exists and is either completed or locked.
+// An expired record, or the record of an abandoned request, is replaced.
+func (s *dbStore) Start(ctx context.Context, record Record) (*Record, error) {
+	now := time.Now().UTC()
+	if err := s.purge(ctx, now); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.With(ctx).NewQuery(
+		"INSERT INTO idempotency_key (key, fingerprint, completed, status, header, locked_until, expires_at) " +
+			"VALUES ({:key}, {:fingerprint}, FALSE, 0, '', {:locked_until}, {:expires_at}) " +
+			"ON CONFLICT (key) DO UPDATE SET fingerprint=excluded.fingerprint, completed=FALSE, status=0, header='', " +
+			"body=NULL, locked_until=excluded.locked_until, expires_at=excluded.expires_at " +
+			"WHERE idempotency_key.expires_at<{:now} OR " +
+			"(NOT idempotency_key.completed AND idempotency_key.locked_until<{:now})",
+	).Bind(dbx.Params{
+		"key":          record.Key,
+		"fingerprint":  record.Fingerprint,
+		"locked_until": record.LockedUntil.UTC(),
+		"expires_at":   record.ExpiresAt.UTC(),
+		"now":          now,
+	}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return nil, err
+	}
+
+	var existing dbRecord
+	if err := s.db.With(ctx).Select().Model(record.Key, &existing); err != nil {
+		if err == sql.ErrNoRows {
+			// the existing record was removed in the meantime
+			return s.Start(ctx, record)
+		}
+		return nil, err
+	}
+	r := Record{
+		Key:         existing.Key,
+		Fingerprint: existing.Fingerprint,
+		Completed:   existing.Completed,
+		Status:      existing.Status,
+		Body:        existing.Body,
+		LockedUntil: existing.LockedUntil,
+		ExpiresAt:   existing.ExpiresAt,
+	}
+	if existing.Header != "" {
+		if err := json.Unmarshal([]byte(existing.Header), &r.Header); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// Save updates the record with the same key in the database, unless it has been taken over by another request.
+func (s *dbStore) Save(ctx context.Context, record Record) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.With(ctx).Update("idempotency_key", dbx.Params{
+		"fingerprint": record.Fingerprint,
+		"completed":   record.Completed,
+		"status":      record.Status,
+		"header":      string(header),
+		"body":        record.Body,
+		"expires_at":  record.ExpiresAt.UTC(),
+	}, dbx.HashExp{"key": record.Key, "locked_until": record.LockedUntil.UTC()}).Execute()
+	return err
+}
+
+// Delete removes the record with the same key from the database, unless it has been taken over by another request.
+func (s *dbStore) Delete(ctx context.Context, record Record) error {
+	_, err := s.db.With(ctx).
+		Delete("idempotency_key", dbx.HashExp{"key": record.Key, "locked_until": record.LockedUntil.UTC()}).
+		Execute()
+	return err
+}
+
+// purge removes the expired records from the database if they have not been removed recently.
+func (s *dbStore) purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.lastPurge) <= purgeInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+
+	_, err := s.db.With(ctx).
+		Delete("idempotency_key", dbx.NewExp("expires_at<{:now}", dbx.Params{"now": now})).
+		Execute()
+	return err
+}
@@ -0,0 +1,38 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDBStore(t *testing.T) {
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_key")
+	testStore(t, NewDBStore(db))
+}
+
+func TestDBStore_purge(t *testing.T) {
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_key")
+	s := NewDBStore(db).(*dbStore)
+	ctx := context.Background()
+	count := func() int {
+		var n int
+		_ = db.With(ctx).Select("COUNT(*)").From("idempotency_key").Row(&n)
+		return n
+	}
+
+	// the expired records are only removed once per purge interval
+	_, _ = s.Start(ctx, Record{Key: "k1", ExpiresAt: time.Now().Add(-time.Second)})
+	_, _ = s.Start(ctx, Record{Key: "k2", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 2, count())
+	s.lastPurge = time.Now().Add(-2 * purgeInterval)
+	_, _ = s.Start(ctx, Record{Key: "k3", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 2, count())
+	_, _ = s.Start(ctx, Record{Key: "k4", ExpiresAt: time.Now().Add(-time.Second)})
+	_, _ = s.Start(ctx, Record{Key: "k5", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 4, count())
+}
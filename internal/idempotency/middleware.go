@@ -0,0 +1,162 @@
+// Package idempotency provides a middleware that makes unsafe HTTP requests safe to retry.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is the response header indicating that the response is a replay of a saved response.
+	HeaderReplayed = "Idempotent-Replayed"
+	// MaxBodySize is the maximum size in bytes of the bodies of the requests carrying idempotency keys.
+	MaxBodySize = 1 << 20
+)
+
+// methods lists the HTTP methods whose requests are handled by the middleware.
+var methods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// Handler returns a middleware that honors the Idempotency-Key header of POST, PATCH and DELETE requests.
+//
+// The response of the first request carrying a key is saved in the store for the given TTL. A retry with the same
+// key and the same request gets the saved response without being processed again. A request reusing the key for
+// a different request is rejected with 409, and a retry arriving while the first request is still being processed
+// is rejected with 422. If a request fails with an error or a server error response, its key is released so that
+// the request can be retried. A request is considered to be in progress for at most the given lock timeout, after
+// which a retry takes over its key, so that the key of a request abandoned by a crashed server is not stuck.
+// The lock timeout should thus be longer than the time taken to process any request.
+//
+// Keys are scoped by the credentials in the Authorization header, so different clients may use the same key.
+// Requests whose bodies are larger than MaxBodySize are rejected with 413.
+func Handler(store Store, ttl, lockTimeout time.Duration, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		key := c.Request.Header.Get(HeaderKey)
+		if key == "" || !methods[c.Request.Method] {
+			return c.Next()
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, MaxBodySize+1))
+		if err != nil {
+			logger.With(c.Request.Context()).Info(err)
+			return errors.BadRequest("")
+		}
+		if len(body) > MaxBodySize {
+			return errors.RequestEntityTooLarge("")
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		now := time.Now()
+		record := Record{
+			Key:         hash(c.Request.Header.Get("Authorization"), key),
+			Fingerprint: hash(c.Request.Method, c.Request.URL.RequestURI(), string(body)),
+			LockedUntil: now.Add(lockTimeout),
+			ExpiresAt:   now.Add(ttl),
+		}
+		existing, err := store.Start(ctx, record)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.Fingerprint != record.Fingerprint {
+				return errors.Conflict("The idempotency key has already been used for a different request.").
+					WithMessageKey("IDEMPOTENCY_KEY_REUSED", nil)
+			}
+			if !existing.Completed {
+				return errors.UnprocessableEntity("A request with the same idempotency key is still being processed.").
+					WithMessageKey("IDEMPOTENCY_KEY_IN_PROGRESS", nil)
+			}
+			replay(c.Response, existing)
+			c.Abort()
+			return nil
+		}
+
+		rw := &responseRecorder{ResponseWriter: c.Response, status: http.StatusOK}
+		c.Response = rw
+		completed := false
+		defer func() {
+			c.Response = rw.ResponseWriter
+			if !completed {
+				// release the key so that the failed request can be retried
+				if err := store.Delete(context.Background(), record); err != nil {
+					logger.With(ctx).Errorf("failed to release idempotency key: %v", err)
+				}
+			}
+		}()
+
+		if err := c.Next(); err != nil || rw.status >= http.StatusInternalServerError {
+			return err
+		}
+
+		record.Completed = true
+		record.Status = rw.status
+		record.Header = rw.Header().Clone()
+		record.Body = rw.body.Bytes()
+		if err := store.Save(ctx, record); err != nil {
+			logger.With(ctx).Errorf("failed to save the response for idempotency key: %v", err)
+			return nil
+		}
+		completed = true
+		return nil
+	}
+}
+
+// replay writes the response saved in the given record.
+func replay(w http.ResponseWriter, record *Record) {
+	header := w.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(HeaderReplayed, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// hash returns the hex-encoded SHA-256 hash of the given values.
+func hash(values ...string) string {
+	h := sha256.New()
+	for _, value := range values {
+		_, _ = h.Write([]byte(value))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder wraps http.ResponseWriter in order to keep a copy of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// Write writes the data to both the response and the copy.
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// WriteHeader records the response status and then writes HTTP headers.
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the wrapped response writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,122 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := NewMemoryStore()
+	router := test.MockRouter(logger)
+	router.Use(Handler(store, time.Hour, time.Minute, logger))
+	calls := 0
+	router.Post("/albums", func(c *routing.Context) error {
+		calls++
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := c.Read(&input); err != nil {
+			return err
+		}
+		if input.Name == "error" {
+			return fmt.Errorf("failed")
+		}
+		c.Response.Header().Set("Location", "/albums/"+input.Name)
+		return c.WriteWithStatus(fmt.Sprintf("created %v %v", input.Name, calls), http.StatusCreated)
+	})
+	router.Put("/albums", func(c *routing.Context) error {
+		calls++
+		return c.Write(calls)
+	})
+
+	// the first request is processed and the retries get the same response
+	res := send(router, "POST", `{"name":"a"}`, "key1", "")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, `"created a 1"`+"\n", res.Body.String())
+	assert.Empty(t, res.Header().Get(HeaderReplayed))
+	res = send(router, "POST", `{"name":"a"}`, "key1", "")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, `"created a 1"`+"\n", res.Body.String())
+	assert.Equal(t, "/albums/a", res.Header().Get("Location"))
+	assert.Equal(t, "true", res.Header().Get(HeaderReplayed))
+	assert.Equal(t, 1, calls)
+
+	// the same key with a different body is rejected
+	res = send(router, "POST", `{"name":"b"}`, "key1", "")
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, 1, calls)
+
+	// keys are scoped by the client credentials
+	res = send(router, "POST", `{"name":"a"}`, "key1", "Bearer other")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, `"created a 2"`+"\n", res.Body.String())
+
+	// requests without a key or using a safe method are not affected
+	send(router, "POST", `{"name":"a"}`, "", "")
+	send(router, "PUT", `{"name":"a"}`, "key1", "")
+	assert.Equal(t, 4, calls)
+
+	// failed requests release their keys
+	res = send(router, "POST", `{"name":"error"}`, "key2", "")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	send(router, "POST", `{"name":"error"}`, "key2", "")
+	assert.Equal(t, 6, calls)
+
+	// requests arriving while the original one is in flight are rejected
+	_, _ = store.Start(context.Background(), Record{
+		Key:         hash("", "key3"),
+		Fingerprint: hash("POST", "/albums", `{"name":"c"}`),
+		LockedUntil: time.Now().Add(time.Minute),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	res = send(router, "POST", `{"name":"c"}`, "key3", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Equal(t, 6, calls)
+
+	// the keys of abandoned requests are taken over
+	_, _ = store.Start(context.Background(), Record{
+		Key:         hash("", "key4"),
+		Fingerprint: hash("POST", "/albums", `{"name":"d"}`),
+		LockedUntil: time.Now().Add(-time.Second),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	res = send(router, "POST", `{"name":"d"}`, "key4", "")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, 7, calls)
+
+	// large requests are rejected
+	res = send(router, "POST", `{"name":"`+strings.Repeat("e", MaxBodySize)+`"}`, "key5", "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	assert.Equal(t, 7, calls)
+}
+
+func Test_hash(t *testing.T) {
+	assert.Equal(t, hash("a", "b"), hash("a", "b"))
+	assert.NotEqual(t, hash("a", "b"), hash("ab", ""))
+	assert.Len(t, hash("a"), 64)
+}
+
+func send(router *routing.Router, method, body, key, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/albums", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
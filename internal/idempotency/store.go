@@ -0,0 +1,104 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record represents the processing state of a request carrying an idempotency key.
+type Record struct {
+	// Key identifies the request. It is derived from the idempotency key and the client credentials.
+	Key string
+	// Fingerprint is the hash of the request method, URL and body.
+	Fingerprint string
+	// Completed indicates whether the request has been processed and its response has been saved.
+	Completed bool
+	// Status is the HTTP status code of the saved response.
+	Status int
+	// Header is the HTTP header of the saved response.
+	Header http.Header
+	// Body is the body of the saved response.
+	Body []byte
+	// LockedUntil is the time until which the request is considered to be in progress. A record that is not completed
+	// when its lock expires belongs to a request that was abandoned, such as by a server crash, and can be taken over
+	// by a retry. It also identifies the request owning the record.
+	LockedUntil time.Time
+	// ExpiresAt is the time after which the record is discarded.
+	ExpiresAt time.Time
+}
+
+// Store persists the records of the requests carrying idempotency keys.
+type Store interface {
+	// Start atomically saves a record for a request that is about to be processed.
+	// If an unexpired record with the same key already exists and is either completed or still locked,
+	// it returns that record and saves nothing. Otherwise it returns nil.
+	Start(ctx context.Context, record Record) (*Record, error)
+	// Save updates the record with the same key, unless it has been taken over by another request.
+	Save(ctx context.Context, record Record) error
+	// Delete removes the record with the same key, unless it has been taken over by another request.
+	Delete(ctx context.Context, record Record) error
+}
+
+// purgeInterval is the interval at which the expired records are removed from the stores.
+const purgeInterval = time.Minute
+
+// memoryStore keeps the records in memory. It can only be used when running a single server instance.
+type memoryStore struct {
+	mu        sync.Mutex
+	records   map[string]Record
+	lastPurge time.Time
+}
+
+// NewMemoryStore creates a new store that keeps the records in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{records: map[string]Record{}, lastPurge: time.Now()}
+}
+
+// Start saves the record unless an unexpired record with the same key exists and is either completed or locked.
+func (s *memoryStore) Start(ctx context.Context, record Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPurge) > purgeInterval {
+		for key, r := range s.records {
+			if r.ExpiresAt.Before(now) {
+				delete(s.records, key)
+			}
+		}
+		s.lastPurge = now
+	}
+	if existing, ok := s.records[record.Key]; ok && existing.ExpiresAt.After(now) &&
+		(existing.Completed || existing.LockedUntil.After(now)) {
+		return &existing, nil
+	}
+	s.records[record.Key] = record
+	return nil, nil
+}
+
+// Save updates the record with the same key, unless it has been taken over by another request.
+func (s *memoryStore) Save(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owns(record) {
+		s.records[record.Key] = record
+	}
+	return nil
+}
+
+// Delete removes the record with the same key, unless it has been taken over by another request.
+func (s *memoryStore) Delete(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owns(record) {
+		delete(s.records, record.Key)
+	}
+	return nil
+}
+
+// owns checks if the record stored with the same key as the given one belongs to the same request.
+func (s *memoryStore) owns(record Record) bool {
+	existing, ok := s.records[record.Key]
+	return ok && existing.LockedUntil.Equal(record.LockedUntil)
+}
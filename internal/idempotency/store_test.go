@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStore_purge(t *testing.T) {
+	s := NewMemoryStore().(*memoryStore)
+	ctx := context.Background()
+	_, _ = s.Start(ctx, Record{Key: "k1", ExpiresAt: time.Now().Add(-time.Second)})
+	_, _ = s.Start(ctx, Record{Key: "k2", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 2, len(s.records))
+	s.lastPurge = time.Now().Add(-2 * purgeInterval)
+	_, _ = s.Start(ctx, Record{Key: "k3", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 2, len(s.records))
+	_, ok := s.records["k1"]
+	assert.False(t, ok)
+}
+
+// testStore verifies the behavior that every Store implementation should have.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	record := Record{
+		Key:         "test1",
+		Fingerprint: "fp1",
+		LockedUntil: time.Now().Add(time.Minute),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	// start
+	existing, err := s.Start(ctx, record)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+	existing, err = s.Start(ctx, Record{Key: "test1", Fingerprint: "fp2", LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+	if assert.NotNil(t, existing) {
+		assert.Equal(t, "fp1", existing.Fingerprint)
+		assert.False(t, existing.Completed)
+	}
+
+	// save
+	record.Completed = true
+	record.Status = http.StatusCreated
+	record.Header = http.Header{"Content-Type": []string{"application/json"}}
+	record.Body = []byte(`{"id":"1"}`)
+	assert.Nil(t, s.Save(ctx, record))
+	existing, err = s.Start(ctx, record)
+	assert.Nil(t, err)
+	if assert.NotNil(t, existing) {
+		assert.True(t, existing.Completed)
+		assert.Equal(t, http.StatusCreated, existing.Status)
+		assert.Equal(t, "application/json", existing.Header.Get("Content-Type"))
+		assert.Equal(t, `{"id":"1"}`, string(existing.Body))
+	}
+
+	// delete
+	assert.Nil(t, s.Delete(ctx, record))
+	existing, err = s.Start(ctx, record)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+	assert.Nil(t, s.Delete(ctx, record))
+
+	// expired records are replaced
+	_, err = s.Start(ctx, Record{Key: "test2", Fingerprint: "fp1", ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+	record2 := Record{Key: "test2", Fingerprint: "fp2", LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour)}
+	existing, err = s.Start(ctx, record2)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+	assert.Nil(t, s.Delete(ctx, record2))
+
+	// the records of abandoned requests are taken over, while the completed ones are kept until they expire
+	abandoned := Record{Key: "test3", Fingerprint: "fp1", LockedUntil: time.Now().Add(-time.Second), ExpiresAt: time.Now().Add(time.Hour)}
+	_, err = s.Start(ctx, abandoned)
+	assert.Nil(t, err)
+	record3 := Record{Key: "test3", Fingerprint: "fp1", LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour)}
+	existing, err = s.Start(ctx, record3)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+	// the abandoned request can no longer change the record
+	abandoned.Completed = true
+	abandoned.Status = http.StatusOK
+	assert.Nil(t, s.Save(ctx, abandoned))
+	assert.Nil(t, s.Delete(ctx, abandoned))
+	existing, err = s.Start(ctx, record3)
+	assert.Nil(t, err)
+	if assert.NotNil(t, existing) {
+		assert.False(t, existing.Completed)
+	}
+	assert.Nil(t, s.Delete(ctx, record3))
+	// a completed record is kept after its lock expires
+	_, err = s.Start(ctx, abandoned)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Save(ctx, abandoned))
+	existing, err = s.Start(ctx, record3)
+	assert.Nil(t, err)
+	if assert.NotNil(t, existing) {
+		assert.True(t, existing.Completed)
+	}
+	assert.Nil(t, s.Delete(ctx, abandoned))
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"sync"
+	"time"
+)
+
+// dbStore keeps the TATs in the database so that they are shared by all server instances.
+type dbStore struct {
+	db        *dbcontext.DB
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewDBStore creates a new store that keeps the TATs in the database.
+func NewDBStore(db *dbcontext.DB) Store {
+	return &dbStore{db: db, lastPurge: time.Now()}
+}
+
+// Update replaces the TAT stored for the key with the one returned by f.
+// The row of the key is locked while f is being called so that concurrent updates are serialized.
+func (s *dbStore) Update(ctx context.Context, key string, f func(tat time.Time) time.Time) error {
+	if err := s.purge(ctx); err != nil {
+		return err
+	}
+	return s.db.Transactional(ctx, func(ctx context.Context) error {
+		// make sure the row exists so that it can be locked
+		_, err := s.db.With(ctx).NewQuery(
+			"INSERT INTO rate_limit (key, tat) VALUES ({:key}, {:tat}) ON CONFLICT (key) DO NOTHING",
+		).Bind(dbx.Params{"key": key, "tat": time.Time{}}).Execute()
+		if err != nil {
+			return err
+		}
+
+		// SQLite does not support row locks, but serializes the transactions writing to the database instead
+		query := "SELECT tat FROM rate_limit WHERE key={:key}"
+		if s.db.DB().DriverName() == "postgres" {
+			query += " FOR UPDATE"
+		}
+		var tat time.Time
+		err = s.db.With(ctx).NewQuery(query).Bind(dbx.Params{"key": key}).Row(&tat)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.With(ctx).Update("rate_limit", dbx.Params{"tat": f(tat).UTC()}, dbx.HashExp{"key": key}).Execute()
+		return err
+	})
+}
+
+// purge removes the TATs in the past from the database if they have not been removed recently.
+func (s *dbStore) purge(ctx context.Context) error {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastPurge) <= purgeInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+
+	_, err := s.db.With(ctx).
+		Delete("rate_limit", dbx.NewExp("tat<{:now}", dbx.Params{"now": now.UTC()})).
+		Execute()
+	return err
+}
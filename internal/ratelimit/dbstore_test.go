@@ -0,0 +1,12 @@
+package ratelimit
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"testing"
+)
+
+func TestDBStore(t *testing.T) {
+	db := test.DB(t)
+	test.ResetTables(t, db, "rate_limit")
+	testStore(t, NewDBStore(db))
+}
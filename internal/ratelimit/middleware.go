@@ -0,0 +1,144 @@
+// Package ratelimit provides a middleware that limits the rate of the requests made by each client.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderLimit is the response header announcing the number of requests allowed at once.
+	HeaderLimit = "RateLimit-Limit"
+	// HeaderRemaining is the response header announcing the number of requests that can still be made at once.
+	HeaderRemaining = "RateLimit-Remaining"
+	// HeaderReset is the response header announcing the seconds after which the limit is fully restored.
+	HeaderReset = "RateLimit-Reset"
+)
+
+// Limit represents the number of requests a client is allowed to make in a period of time.
+type Limit struct {
+	// Requests is the number of requests allowed in each period. Zero means no limit.
+	Requests int
+	// Period is the length of the period.
+	Period time.Duration
+	// Burst is the maximum number of requests allowed at once. Defaults to Requests.
+	Burst int
+}
+
+// result represents the outcome of checking a request against a limit.
+type result struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// Handler returns a middleware that limits the rate of the requests made by each client.
+//
+// Clients are identified by the authenticated user ID, or else by the client IP address, which is taken from
+// the X-Forwarded-For header only if the request comes from one of the given trusted proxies (see accesslog.ClientIP).
+// Use auth.IdentityHandler before this middleware so that the authenticated users can be identified. The headers
+// that the clients can set freely are not used, so that a client cannot get a new limit by changing them.
+// The given limit applies to all requests unless routes contains a limit for the route being requested. The keys
+// of routes are route patterns such as "POST /v1/albums" (see routematch.New), and each route limit is enforced
+// separately from the default one. The limits are enforced using the generic cell rate algorithm (GCRA).
+//
+// The state of the limit is announced via the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// Requests exceeding the limit are rejected with 429 and a Retry-After header. If the store fails, the request
+// is let through. The middleware panics if routes contains an invalid route pattern or trustedProxies contains
+// an invalid IP address or CIDR range.
+func Handler(store Store, limit Limit, routes map[string]Limit, trustedProxies []string, logger log.Logger) routing.Handler {
+	proxies, err := accesslog.ParseProxies(trustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	var patterns []string
+	for pattern := range routes {
+		patterns = append(patterns, pattern)
+	}
+	matcher, err := routematch.New(patterns...)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *routing.Context) error {
+		key := clientKey(c.Request, proxies)
+		l := limit
+		if pattern, ok := matcher.Match(c.Request.Method, c.Request.URL.Path); ok {
+			key += " " + pattern
+			l = routes[pattern]
+		}
+		if l.Requests <= 0 || l.Period <= 0 {
+			return nil
+		}
+
+		ctx := c.Request.Context()
+		r, err := l.take(ctx, store, key, time.Now())
+		if err != nil {
+			logger.With(ctx).Errorf("failed to check the rate limit: %v", err)
+			return nil
+		}
+
+		header := c.Response.Header()
+		header.Set(HeaderLimit, strconv.Itoa(r.limit))
+		header.Set(HeaderRemaining, strconv.Itoa(r.remaining))
+		header.Set(HeaderReset, seconds(r.reset))
+		if !r.allowed {
+			retryAfter := seconds(r.retryAfter)
+			header.Set("Retry-After", retryAfter)
+			return errors.TooManyRequests(fmt.Sprintf("You have made too many requests. Please try again in %v seconds.", retryAfter)).
+				WithMessageKey("RATE_LIMIT_EXCEEDED", map[string]interface{}{"seconds": retryAfter})
+		}
+		return nil
+	}
+}
+
+// take checks a request made at the given time against the limit and records it if it is allowed.
+func (l Limit) take(ctx context.Context, store Store, key string, now time.Time) (result, error) {
+	burst := l.Burst
+	if burst <= 0 {
+		burst = l.Requests
+	}
+	interval := l.Period / time.Duration(l.Requests)
+	tolerance := interval * time.Duration(burst)
+
+	var r result
+	err := store.Update(ctx, key, func(tat time.Time) time.Time {
+		if tat.Before(now) {
+			tat = now
+		}
+		next := tat.Add(interval)
+		allowAt := next.Add(-tolerance)
+		if now.Before(allowAt) {
+			r = result{limit: burst, reset: tat.Sub(now), retryAfter: allowAt.Sub(now)}
+			return tat
+		}
+		r = result{allowed: true, limit: burst, remaining: int(now.Sub(allowAt) / interval), reset: next.Sub(now)}
+		return next
+	})
+	return r, err
+}
+
+// clientKey returns the key identifying the client making the request.
+func clientKey(req *http.Request, proxies []*net.IPNet) string {
+	if user := auth.CurrentUser(req.Context()); user != nil {
+		return "user:" + user.GetID()
+	}
+	return "ip:" + accesslog.ClientIP(req, proxies)
+}
+
+// seconds formats the duration as a number of seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
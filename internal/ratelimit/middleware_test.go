@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	router.Use(Handler(NewMemoryStore(), Limit{Requests: 2, Period: time.Hour}, map[string]Limit{
+		"POST /albums":     {Requests: 1, Period: time.Hour},
+		"GET /albums/<id>": {},
+	}, []string{"10.0.0.0/8"}, logger))
+	ok := func(c *routing.Context) error { return c.Write("ok") }
+	router.Get("/albums", ok)
+	router.Post("/albums", ok)
+	router.Get("/albums/<id>", ok)
+
+	// the default limit
+	res := send(router, "GET", "/albums", "1.1.1.1:80", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2", res.Header().Get(HeaderLimit))
+	assert.Equal(t, "1", res.Header().Get(HeaderRemaining))
+	assert.Equal(t, "1800", res.Header().Get(HeaderReset))
+	res = send(router, "GET", "/albums", "1.1.1.1:80", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "0", res.Header().Get(HeaderRemaining))
+	res = send(router, "GET", "/albums", "1.1.1.1:80", nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "0", res.Header().Get(HeaderRemaining))
+	assert.Equal(t, "1800", res.Header().Get("Retry-After"))
+	assert.Contains(t, res.Body.String(), `"status":429`)
+	assert.Contains(t, res.Body.String(), "Please try again in 1800 seconds.")
+
+	// other clients are limited separately
+	res = send(router, "GET", "/albums", "2.2.2.2:80", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	header := http.Header{}
+	header.Set("X-Forwarded-For", "3.3.3.3")
+	res = send(router, "GET", "/albums", "10.0.0.1:80", header)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	// the headers set by the clients are ignored unless they come from a trusted proxy
+	header = http.Header{}
+	header.Set("X-Forwarded-For", "4.4.4.4")
+	header.Set("X-Real-IP", "4.4.4.4")
+	header.Set("X-API-Key", "abc")
+	res = send(router, "GET", "/albums", "1.1.1.1:80", header)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+
+	// route limits are enforced separately from the default one
+	res = send(router, "POST", "/albums", "1.1.1.1:80", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "1", res.Header().Get(HeaderLimit))
+	res = send(router, "POST", "/albums", "1.1.1.1:80", nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+
+	// a route limit without requests disables the limit
+	for i := 0; i < 3; i++ {
+		res = send(router, "GET", "/albums/1", "1.1.1.1:80", nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Header().Get(HeaderLimit))
+	}
+}
+
+func TestHandler_invalidRoute(t *testing.T) {
+	logger, _ := log.NewForTest()
+	assert.Panics(t, func() {
+		Handler(NewMemoryStore(), Limit{}, map[string]Limit{"GET albums": {}}, nil, logger)
+	})
+	assert.Panics(t, func() {
+		Handler(NewMemoryStore(), Limit{}, nil, []string{"abc"}, logger)
+	})
+}
+
+func TestLimit_take(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+	l := Limit{Requests: 10, Period: 10 * time.Second, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		r, err := l.take(ctx, store, "test", now)
+		assert.Nil(t, err)
+		assert.True(t, r.allowed)
+		assert.Equal(t, 3, r.limit)
+		assert.Equal(t, i, r.remaining)
+	}
+	r, err := l.take(ctx, store, "test", now)
+	assert.Nil(t, err)
+	assert.False(t, r.allowed)
+	assert.Equal(t, time.Second, r.retryAfter)
+	assert.Equal(t, 3*time.Second, r.reset)
+
+	// a request is allowed again after the emission interval
+	r, _ = l.take(ctx, store, "test", now.Add(time.Second))
+	assert.True(t, r.allowed)
+	assert.Equal(t, 0, r.remaining)
+
+	// the burst defaults to the number of requests
+	l = Limit{Requests: 10, Period: 10 * time.Second}
+	r, _ = l.take(ctx, store, "test2", now)
+	assert.Equal(t, 10, r.limit)
+	assert.Equal(t, 9, r.remaining)
+}
+
+func Test_clientKey(t *testing.T) {
+	proxies, _ := accesslog.ParseProxies([]string{"10.0.0.0/8"})
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.1.1.1:80"
+	req.Header.Set("X-Forwarded-For", "2.2.2.2")
+	req.Header.Set("X-API-Key", "abc")
+	assert.Equal(t, "ip:1.1.1.1", clientKey(req, proxies))
+	req.RemoteAddr = "10.0.0.1:80"
+	assert.Equal(t, "ip:2.2.2.2", clientKey(req, proxies))
+	req = req.WithContext(auth.WithUser(req.Context(), "100", "test"))
+	assert.Equal(t, "user:100", clientKey(req, proxies))
+}
+
+func send(router *routing.Router, method, url, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, nil)
+	if header != nil {
+		req.Header = header
+	}
+	req.RemoteAddr = remoteAddr
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps the theoretical arrival times (TAT) of the rate-limited clients.
+// A TAT is the time at which the next request of a client would conform to its rate limit if the client
+// made its requests at the exact rate allowed.
+type Store interface {
+	// Update atomically replaces the TAT stored for the key with the one returned by f.
+	// f is given the zero time if no TAT is stored for the key. TATs in the past may be discarded.
+	Update(ctx context.Context, key string, f func(tat time.Time) time.Time) error
+}
+
+// purgeInterval is the interval at which the TATs in the past are removed from the stores.
+const purgeInterval = time.Minute
+
+// memoryStore keeps the TATs in memory. It can only be used when running a single server instance.
+type memoryStore struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewMemoryStore creates a new store that keeps the TATs in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{tats: map[string]time.Time{}, lastPurge: time.Now()}
+}
+
+// Update replaces the TAT stored for the key with the one returned by f.
+func (s *memoryStore) Update(ctx context.Context, key string, f func(tat time.Time) time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastPurge) > purgeInterval {
+		for k, tat := range s.tats {
+			if tat.Before(now) {
+				delete(s.tats, k)
+			}
+		}
+		s.lastPurge = now
+	}
+	s.tats[key] = f(s.tats[key])
+	return nil
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStore_purge(t *testing.T) {
+	s := NewMemoryStore().(*memoryStore)
+	ctx := context.Background()
+	_ = s.Update(ctx, "k1", func(time.Time) time.Time { return time.Now().Add(-time.Second) })
+	_ = s.Update(ctx, "k2", func(time.Time) time.Time { return time.Now().Add(time.Hour) })
+	assert.Equal(t, 2, len(s.tats))
+	s.lastPurge = time.Now().Add(-2 * purgeInterval)
+	_ = s.Update(ctx, "k3", func(time.Time) time.Time { return time.Now().Add(time.Hour) })
+	assert.Equal(t, 2, len(s.tats))
+	_, ok := s.tats["k1"]
+	assert.False(t, ok)
+}
+
+// testStore verifies the behavior that every Store implementation should have.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	tat := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	// a new key has no TAT
+	err := s.Update(ctx, "test1", func(got time.Time) time.Time {
+		assert.True(t, got.IsZero())
+		return tat
+	})
+	assert.Nil(t, err)
+
+	// the TAT returned by the function is stored
+	err = s.Update(ctx, "test1", func(got time.Time) time.Time {
+		assert.True(t, tat.Equal(got))
+		return tat.Add(time.Second)
+	})
+	assert.Nil(t, err)
+	err = s.Update(ctx, "test1", func(got time.Time) time.Time {
+		assert.True(t, tat.Add(time.Second).Equal(got))
+		return got
+	})
+	assert.Nil(t, err)
+
+	// keys are independent of each other
+	err = s.Update(ctx, "test2", func(got time.Time) time.Time {
+		assert.True(t, got.IsZero())
+		return got
+	})
+	assert.Nil(t, err)
+}
@@ -1,11 +1,17 @@
 package test
 
 import (
+	"context"
 	dbx "github.com/go-ozzo/ozzo-dbx"
-	_ "github.com/lib/pq" // initialize posgresql for test
+	_ "github.com/lib/pq"           // initialize posgresql for test
+	_ "github.com/mattn/go-sqlite3" // initialize sqlite for test
 	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/migrations"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/fixture"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/migrate"
+	"os"
 	"path"
 	"runtime"
 	"testing"
@@ -14,6 +20,8 @@ import (
 var db *dbcontext.DB
 
 // DB returns the database connection for testing purpose.
+// It connects to the database configured in config/local.yml, or to an in-memory SQLite database migrated with
+// the embedded migrations if the configured database is unavailable, so that the tests can run without PostgreSQL.
 func DB(t *testing.T) *dbcontext.DB {
 	if db != nil {
 		return db
@@ -25,16 +33,36 @@ func DB(t *testing.T) *dbcontext.DB {
 		t.Error(err)
 		t.FailNow()
 	}
-	dbc, err := dbx.MustOpen("postgres", cfg.DSN)
+	dbc, err := dbcontext.Open(cfg.DSN, dbcontext.Options{Driver: cfg.DB.Driver}, nil)
 	if err != nil {
-		t.Error(err)
-		t.FailNow()
+		t.Logf("using an in-memory SQLite database as the configured database is unavailable: %v", err)
+		if dbc, err = openSQLite(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
 	}
 	dbc.LogFunc = logger.Infof
 	db = dbcontext.New(dbc)
 	return db
 }
 
+// openSQLite opens an in-memory SQLite database and applies the migrations to it.
+func openSQLite() (*dbx.DB, error) {
+	db, err := dbcontext.Open(":memory:", dbcontext.Options{Driver: "sqlite3"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := migrations.For("sqlite3")
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.New(db.DB(), "sqlite3", fsys, nil)
+	if err != nil {
+		return nil, err
+	}
+	return db, m.Up(context.Background())
+}
+
 // ResetTables truncates all data in the specified tables.
 func ResetTables(t *testing.T, db *dbcontext.DB, tables ...string) {
 	for _, table := range tables {
@@ -46,6 +74,24 @@ func ResetTables(t *testing.T, db *dbcontext.DB, tables ...string) {
 	}
 }
 
+// Fixtures replaces all data in the specified tables with their fixtures in the "testdata/fixtures" directory
+// of the package being tested, and returns the fixtures loaded. See the fixture package for the format of the files.
+func Fixtures(t *testing.T, db *dbcontext.DB, tables ...string) []fixture.Table {
+	fixtures, err := fixture.Load(os.DirFS("testdata/fixtures"), tables...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = db.Transactional(context.Background(), func(ctx context.Context) error {
+		return fixture.Insert(ctx, db.With(ctx), fixtures)
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return fixtures
+}
+
 // getSourcePath returns the directory containing the source code that is calling this function.
 func getSourcePath() string {
 	_, filename, _, _ := runtime.Caller(1)
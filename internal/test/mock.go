@@ -26,8 +26,8 @@ func MockRoutingContext(req *http.Request) (*routing.Context, *httptest.Response
 func MockRouter(logger log.Logger) *routing.Router {
 	router := routing.New()
 	router.Use(
-		accesslog.Handler(logger),
-		errors.Handler(logger),
+		accesslog.Handler(logger, accesslog.Options{}),
+		errors.Handler(logger, errors.Options{}),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
 	)
@@ -0,0 +1,15 @@
+package version
+
+import routing "github.com/go-ozzo/ozzo-routing/v2"
+
+// RegisterHandlers registers the handler reporting the build and runtime information of the server.
+func RegisterHandlers(r *routing.Router, service Service) {
+	r.Get("/version", get(service))
+}
+
+// get returns a handler that responds with the build and runtime information of the server.
+func get(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		return c.Write(service.Get(c.Request.Context()))
+	}
+}
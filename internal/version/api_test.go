@@ -0,0 +1,29 @@
+package version
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	cfg := &config.Config{Env: "dev", JWTSigningKey: "key"}
+	build := buildinfo.Info{Version: "1.0.0", Commit: "abc", GoVersion: "go1.18"}
+	RegisterHandlers(router, NewService(build, cfg, &mockRepository{migration: Migration{Version: 20200101}}, time.Now(), logger))
+
+	tests := []test.APITestCase{
+		{"version", "GET", "/version", "", nil, http.StatusOK, `*"version":"1.0.0","commit":"abc","dirty":false,"go_version":"go1.18"*`},
+		{"migration", "GET", "/version", "", nil, http.StatusOK, `*"migration":{"version":20200101,"dirty":false}*`},
+		{"features", "GET", "/version", "", nil, http.StatusOK, `*"features":{"admin_api":false*`},
+		{"config without secrets", "GET", "/version", "", nil, http.StatusOK, `*"debug":false,"env":"dev"*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
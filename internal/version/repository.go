@@ -0,0 +1,31 @@
+package version
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access the state of the database schema.
+type Repository interface {
+	// Migration returns the version of the latest database migration applied.
+	Migration(ctx context.Context) (Migration, error)
+}
+
+// repository reads the state of the database schema from the database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new repository reading the state of the database schema.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Migration reads the migration version recorded by the migration tool.
+func (r repository) Migration(ctx context.Context) (Migration, error) {
+	var m Migration
+	err := r.db.With(ctx).Select("version", "dirty").From("schema_migrations").Limit(1).Row(&m.Version, &m.Dirty)
+	return m, err
+}
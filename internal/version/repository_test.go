@@ -0,0 +1,20 @@
+package version
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	repo := NewRepository(db, logger)
+
+	m, err := repo.Migration(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, m.Version > 0)
+	assert.False(t, m.Dirty)
+}
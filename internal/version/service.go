@@ -0,0 +1,75 @@
+package version
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Service encapsulates the logic of reporting the build and runtime information of the server.
+type Service interface {
+	// Get returns the build and runtime information of the server.
+	Get(ctx context.Context) Info
+}
+
+// Info represents the build and runtime information of the server.
+type Info struct {
+	buildinfo.Info
+	// the time the server has been running for
+	Uptime string `json:"uptime"`
+	// the environment the server runs in
+	Env string `json:"env"`
+	// the latest database migration applied, if known
+	Migration *Migration `json:"migration,omitempty"`
+	// whether each of the optional features of the server is enabled
+	Features map[string]bool `json:"features"`
+	// the configuration of the server, without the secrets
+	Config map[string]interface{} `json:"config"`
+}
+
+// Migration represents the state of the database schema.
+type Migration struct {
+	// the version of the latest migration applied
+	Version int64 `json:"version"`
+	// whether the latest migration failed halfway and the schema needs to be fixed manually
+	Dirty bool `json:"dirty"`
+}
+
+type service struct {
+	build  buildinfo.Info
+	cfg    *config.Config
+	repo   Repository
+	start  time.Time
+	logger log.Logger
+}
+
+// NewService creates a new service reporting the given build information and configuration.
+// The information includes the dependencies and configuration of the server, so it should not be exposed publicly.
+// The uptime is measured from the given start time.
+// The repository may be nil if the application has no database.
+func NewService(build buildinfo.Info, cfg *config.Config, repo Repository, start time.Time, logger log.Logger) Service {
+	return service{build, cfg, repo, start, logger}
+}
+
+// Get returns the build and runtime information of the server.
+// The migration version is omitted if it cannot be read from the database.
+func (s service) Get(ctx context.Context) Info {
+	info := Info{
+		Info:     s.build,
+		Uptime:   time.Since(s.start).Truncate(time.Second).String(),
+		Env:      s.cfg.Env,
+		Features: s.cfg.Features(),
+		Config:   s.cfg.Public(),
+	}
+	if s.repo == nil {
+		return info
+	}
+	if m, err := s.repo.Migration(ctx); err == nil {
+		info.Migration = &m
+	} else {
+		s.logger.With(ctx).Errorf("failed to read the migration version: %v", err)
+	}
+	return info
+}
@@ -0,0 +1,3 @@
+DROP TRIGGER album_event_notify ON album_event;
+DROP FUNCTION notify_album_event();
+DROP TABLE album_event;
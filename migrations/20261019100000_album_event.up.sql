@@ -0,0 +1,23 @@
+CREATE TABLE album_event
+(
+    seq        BIGSERIAL PRIMARY KEY,
+    type       VARCHAR NOT NULL,
+    album_id   VARCHAR NOT NULL,
+    user_id    VARCHAR NOT NULL DEFAULT '',
+    payload    TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE FUNCTION notify_album_event() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('album_event', NEW.seq::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER album_event_notify
+    AFTER INSERT
+    ON album_event
+    FOR EACH ROW
+EXECUTE PROCEDURE notify_album_event();
@@ -0,0 +1,7 @@
+CREATE TABLE rate_limit
+(
+    key VARCHAR PRIMARY KEY,
+    tat TIMESTAMP NOT NULL
+);
+
+CREATE INDEX rate_limit_tat_idx ON rate_limit (tat);
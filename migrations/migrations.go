@@ -0,0 +1,27 @@
+// Package migrations embeds the SQL files of the database migrations into the binary.
+//
+// The migrations of PostgreSQL are in the root directory, while those of SQLite are in the "sqlite3" directory.
+// Both sets must have the same versions so that the schema is the same regardless of the database.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// FS contains the up and down SQL files of the database migrations.
+//
+//go:embed *.sql sqlite3/*.sql
+var FS embed.FS
+
+// For returns the migration files for the given database driver: "postgres" or "sqlite3".
+func For(driver string) (fs.FS, error) {
+	switch driver {
+	case "postgres":
+		return FS, nil
+	case "sqlite3":
+		return fs.Sub(FS, "sqlite3")
+	}
+	return nil, fmt.Errorf("no migrations for the database driver %q", driver)
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/qiangxue/go-rest-api/pkg/migrate"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	var versions [][]int64
+	for _, driver := range []string{"postgres", "sqlite3"} {
+		fsys, err := For(driver)
+		if !assert.Nil(t, err, driver) {
+			continue
+		}
+		migrations, err := migrate.Load(fsys)
+		assert.Nil(t, err, driver)
+		if assert.NotEmpty(t, migrations, driver) {
+			assert.Equal(t, "init", migrations[0].Name)
+		}
+		var v []int64
+		for _, m := range migrations {
+			assert.NotEmpty(t, m.Up, m.Name)
+			assert.NotEmpty(t, m.Down, m.Name)
+			v = append(v, m.Version)
+		}
+		versions = append(versions, v)
+	}
+	// the migrations of all databases have the same versions
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, versions[0], versions[1])
+	}
+
+	_, err := For("mysql")
+	assert.NotNil(t, err)
+}
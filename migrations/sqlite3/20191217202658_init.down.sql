@@ -0,0 +1 @@
+DROP TABLE album;
\ No newline at end of file
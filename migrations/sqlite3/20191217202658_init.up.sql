@@ -0,0 +1,7 @@
+CREATE TABLE album
+(
+    id         VARCHAR PRIMARY KEY,
+    name       VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
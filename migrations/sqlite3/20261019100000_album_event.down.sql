@@ -0,0 +1 @@
+DROP TABLE album_event;
@@ -0,0 +1,9 @@
+CREATE TABLE album_event
+(
+    seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+    type       VARCHAR NOT NULL,
+    album_id   VARCHAR NOT NULL,
+    user_id    VARCHAR NOT NULL DEFAULT '',
+    payload    TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
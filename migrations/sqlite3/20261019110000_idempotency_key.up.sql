@@ -0,0 +1,13 @@
+CREATE TABLE idempotency_key
+(
+    key          VARCHAR PRIMARY KEY,
+    fingerprint  VARCHAR NOT NULL,
+    completed    BOOLEAN NOT NULL,
+    status       INTEGER NOT NULL,
+    header       TEXT NOT NULL,
+    body         BLOB,
+    locked_until TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
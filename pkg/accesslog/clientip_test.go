@@ -0,0 +1,47 @@
+package accesslog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestParseProxies(t *testing.T) {
+	nets, err := ParseProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	if assert.Nil(t, err) && assert.Len(t, nets, 3) {
+		assert.Equal(t, "10.0.0.1/32", nets[0].String())
+		assert.Equal(t, "192.168.0.0/16", nets[1].String())
+		assert.Equal(t, "::1/128", nets[2].String())
+	}
+	_, err = ParseProxies([]string{"abc"})
+	assert.NotNil(t, err)
+	_, err = ParseProxies([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseProxies([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy", "192.168.1.1:1234", nil, "192.168.1.1"},
+		{"untrusted proxy", "192.168.1.1:1234", []string{"1.2.3.4"}, "192.168.1.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"proxy chain", "10.0.0.1:1234", []string{"5.6.7.8, 1.2.3.4", "10.0.0.2"}, "1.2.3.4"},
+		{"trusted chain", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"trusted proxy without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, f := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, proxies))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package accesslog
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"net/http"
+)
+
+// unwrapper is implemented by the response writers wrapping other response writers.
+type unwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// Flush sends the buffered data of the given response writer to the client, looking through the response writers
+// wrapping the one that can flush. The wrappers are recognized by their Unwrap() http.ResponseWriter methods,
+// besides access.LogResponseWriter which has none. It returns whether the data was flushed.
+func Flush(w http.ResponseWriter) bool {
+	for w != nil {
+		switch v := w.(type) {
+		case http.Flusher:
+			v.Flush()
+			return true
+		case *access.LogResponseWriter:
+			w = v.ResponseWriter
+		case unwrapper:
+			w = v.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// LogResponseWriter returns the access.LogResponseWriter among the given response writer and those it wraps, if any.
+// The wrappers are recognized by their Unwrap() http.ResponseWriter methods.
+func LogResponseWriter(w http.ResponseWriter) (*access.LogResponseWriter, bool) {
+	for w != nil {
+		switch v := w.(type) {
+		case *access.LogResponseWriter:
+			return v, true
+		case unwrapper:
+			w = v.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
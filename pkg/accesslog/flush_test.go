@@ -0,0 +1,39 @@
+package accesslog
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// wrapper is a response writer that wraps another one without flushing.
+type wrapper struct {
+	http.ResponseWriter
+}
+
+func (w wrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestFlush(t *testing.T) {
+	res := httptest.NewRecorder()
+	assert.True(t, Flush(wrapper{&access.LogResponseWriter{ResponseWriter: wrapper{res}}}))
+	assert.True(t, res.Flushed)
+
+	// a wrapper that cannot be looked through
+	assert.False(t, Flush(struct{ http.ResponseWriter }{httptest.NewRecorder()}))
+}
+
+func TestLogResponseWriter(t *testing.T) {
+	rw := &access.LogResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	found, ok := LogResponseWriter(wrapper{wrapper{rw}})
+	assert.True(t, ok)
+	assert.Equal(t, rw, found)
+
+	_, ok = LogResponseWriter(wrapper{httptest.NewRecorder()})
+	assert.False(t, ok)
+	_, ok = LogResponseWriter(struct{ http.ResponseWriter }{rw})
+	assert.False(t, ok)
+}
@@ -2,33 +2,231 @@
 package accesslog
 
 import (
+	"context"
+	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/access"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"io"
+	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// The formats of the access log messages.
+const (
+	// FormatDefault logs the method, path, protocol, status and response size in the message,
+	// and the duration and status as fields.
+	FormatDefault = "default"
+	// FormatCombined logs the message in the Apache/NCSA combined log format.
+	FormatCombined = "combined"
+	// FormatJSON logs the details of the request as structured fields.
+	FormatJSON = "json"
+)
+
+// Options represents the options of the access log middleware.
+type Options struct {
+	// Format is the format of the log messages: FormatDefault, FormatCombined or FormatJSON. Defaults to FormatDefault.
+	Format string
+	// TrustedProxies lists the IP addresses or CIDR ranges of the proxies whose X-Forwarded-For headers are trusted
+	// when determining the client IP. The header is ignored if the request does not come from a trusted proxy.
+	TrustedProxies []string
+	// SampleRate is the fraction of the successful requests (with status codes below 400) that are logged.
+	// The requests that fail or are slow are always logged. Zero or one means all requests are logged.
+	SampleRate float64
+	// Exclude lists the route patterns (see routematch.New) of the requests that are not logged, such as "/healthcheck".
+	Exclude []string
+	// SlowThreshold is the duration above which requests are logged at WARN level with their details. Zero means never.
+	SlowThreshold time.Duration
+	// UserID returns the ID of the authenticated user making the request, if any.
+	UserID func(ctx context.Context) string
+}
+
 // Handler returns a middleware that records an access log message for every HTTP request being processed.
-func Handler(logger log.Logger) routing.Handler {
+//
+// The middleware panics if the options contain an invalid trusted proxy or route pattern.
+func Handler(logger log.Logger, options Options) routing.Handler {
+	proxies, err := ParseProxies(options.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	exclude, err := routematch.New(options.Exclude...)
+	if err != nil {
+		panic(err)
+	}
+	var (
+		once   sync.Once
+		routes *routematch.Matcher
+	)
+
 	return func(c *routing.Context) error {
+		once.Do(func() {
+			routes = routematch.NewForRouter(c.Router())
+		})
+
 		start := time.Now()
 
 		rw := &access.LogResponseWriter{ResponseWriter: c.Response, Status: http.StatusOK}
 		c.Response = rw
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
 
 		// associate request ID and session ID with the request context
 		// so that they can be added to the log messages
 		ctx := c.Request.Context()
 		ctx = log.WithRequest(ctx, c.Request)
+		extra := &fields{}
+		ctx = context.WithValue(ctx, fieldsKey, extra)
 		c.Request = c.Request.WithContext(ctx)
+		req := c.Request
 
 		err := c.Next()
 
+		if _, excluded := exclude.Match(req.Method, req.URL.Path); excluded {
+			return err
+		}
+		duration := time.Now().Sub(start)
+		slow := options.SlowThreshold > 0 && duration >= options.SlowThreshold
+		more := extra.get()
+		// the requests with additional fields, such as the captured bodies, are not sampled out
+		if err == nil && rw.Status < http.StatusBadRequest && !slow && len(more) == 0 &&
+			options.SampleRate > 0 && options.SampleRate < 1 && rand.Float64() >= options.SampleRate {
+			return err
+		}
+
 		// generate an access log message
-		logger.With(ctx, "duration", time.Now().Sub(start).Milliseconds(), "status", rw.Status).
-			Infof("%s %s %s %d %d", c.Request.Method, c.Request.URL.Path, c.Request.Proto, rw.Status, rw.BytesWritten)
+		e := entry{
+			req:      req,
+			status:   rw.Status,
+			size:     rw.BytesWritten,
+			reqSize:  body.n,
+			duration: duration,
+			clientIP: ClientIP(req, proxies),
+			time:     start,
+		}
+		if pattern, ok := routes.Match(req.Method, req.URL.Path); ok {
+			e.route = routematch.Path(pattern)
+		}
+		if options.UserID != nil {
+			// the authentication middlewares store the user in the context of the request they pass on
+			e.userID = options.UserID(c.Request.Context())
+		}
+
+		var args []interface{}
+		if slow || options.Format == FormatJSON {
+			args = e.fields()
+		} else if options.Format != FormatCombined {
+			args = []interface{}{"duration", duration.Milliseconds(), "status", rw.Status}
+		}
+		if ctx.Err() == context.Canceled {
+			// the client closed the connection before the response was completed
+			args = append(args, "canceled", true)
+		}
+		args = append(args, more...)
+		l := logger.With(ctx, args...)
+		msg := e.message(options.Format)
+		if slow {
+			l.With(nil, "slow", true).Warnf("slow request: %s", msg)
+		} else {
+			l.Info(msg)
+		}
 
 		return err
 	}
 }
+
+type contextKey int
+
+const fieldsKey contextKey = iota
+
+// fields holds the additional fields of an access log message.
+type fields struct {
+	mu   sync.Mutex
+	args []interface{}
+}
+
+// get returns a copy of the additional fields.
+func (f *fields) get() []interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]interface{}(nil), f.args...)
+}
+
+// AddFields adds the given key-value pairs as fields to the access log message of the request with the given context,
+// so that the middlewares and handlers processing the request can attach more details to it.
+// It does nothing if the request is not processed by the access log middleware.
+func AddFields(ctx context.Context, args ...interface{}) {
+	f, ok := ctx.Value(fieldsKey).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.args = append(f.args, args...)
+}
+
+// entry represents the information logged about a request.
+type entry struct {
+	req      *http.Request
+	route    string
+	status   int
+	size     int64
+	reqSize  int64
+	duration time.Duration
+	clientIP string
+	userID   string
+	time     time.Time
+}
+
+// message returns the log message in the given format.
+func (e entry) message(format string) string {
+	if format != FormatCombined {
+		return fmt.Sprintf("%s %s %s %d %d", e.req.Method, e.req.URL.Path, e.req.Proto, e.status, e.size)
+	}
+	user, size := "-", "-"
+	if e.userID != "" {
+		user = e.userID
+	}
+	if e.size > 0 {
+		size = fmt.Sprint(e.size)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s %q %q`,
+		e.clientIP, user, e.time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.req.Method, e.req.URL.RequestURI(), e.req.Proto, e.status, size,
+		e.req.Referer(), e.req.UserAgent())
+}
+
+// fields returns the details of the request as log fields.
+func (e entry) fields() []interface{} {
+	return []interface{}{
+		"method", e.req.Method,
+		"path", e.req.URL.Path,
+		"route", e.route,
+		"proto", e.req.Proto,
+		"status", e.status,
+		"duration", e.duration.Milliseconds(),
+		"client_ip", e.clientIP,
+		"user_agent", e.req.UserAgent(),
+		"referer", e.req.Referer(),
+		"user_id", e.userID,
+		"request_size", e.reqSize,
+		"response_size", e.size,
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read is required by the io.Reader interface.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -1,12 +1,18 @@
 package accesslog
 
 import (
+	"bytes"
+	"context"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestHandler(t *testing.T) {
@@ -15,10 +21,151 @@ func TestHandler(t *testing.T) {
 	ctx := routing.NewContext(res, req)
 
 	logger, entries := log.NewForTest()
-	handler := Handler(logger)
+	handler := Handler(logger, Options{})
 	err := handler(ctx)
 
 	assert.Nil(t, err)
 	assert.Equal(t, 1, entries.Len())
 	assert.Equal(t, "GET /users HTTP/1.1 200 0", entries.All()[0].Message)
 }
+
+func TestHandler_canceled(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	reqCtx, cancel := context.WithCancel(req.Context())
+	ctx := routing.NewContext(res, req.WithContext(reqCtx), func(c *routing.Context) error {
+		cancel()
+		return nil
+	})
+
+	logger, entries := log.NewForTest()
+	handler := Handler(logger, Options{})
+	err := handler(ctx)
+
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, true, entries.All()[0].ContextMap()["canceled"])
+	}
+}
+
+type testKey int
+
+const userKey testKey = iota
+
+// serve processes a request by a router using the access log middleware with the given options.
+func serve(options Options, req *http.Request) *observer.ObservedLogs {
+	logger, entries := log.NewForTest()
+	options.UserID = func(ctx context.Context) string {
+		id, _ := ctx.Value(userKey).(string)
+		return id
+	}
+	router := routing.New()
+	router.Use(Handler(logger, options))
+	router.Post("/users/<id>", func(c *routing.Context) error {
+		_, _ = ioutil.ReadAll(c.Request.Body)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), userKey, "100"))
+		return c.Write("created")
+	})
+	router.Get("/healthcheck", func(c *routing.Context) error {
+		return c.Write("OK")
+	})
+	router.Get("/slow", func(c *routing.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.Write("OK")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return entries
+}
+
+func newRequest(method, url, body string) *http.Request {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.2")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "http://example.com")
+	return req
+}
+
+func TestHandler_json(t *testing.T) {
+	entries := serve(Options{Format: FormatJSON, TrustedProxies: []string{"10.0.0.0/8"}}, newRequest("POST", "http://127.0.0.1/users/1", "data"))
+	if assert.Equal(t, 1, entries.Len()) {
+		e := entries.All()[0]
+		assert.Equal(t, zapcore.InfoLevel, e.Level)
+		assert.Equal(t, "POST /users/1 HTTP/1.1 200 7", e.Message)
+		fields := e.ContextMap()
+		assert.Equal(t, "/users/<id>", fields["route"])
+		assert.Equal(t, "192.168.1.1", fields["client_ip"])
+		assert.Equal(t, "test-agent", fields["user_agent"])
+		assert.Equal(t, "http://example.com", fields["referer"])
+		assert.Equal(t, "100", fields["user_id"])
+		assert.Equal(t, int64(4), fields["request_size"])
+		assert.Equal(t, int64(7), fields["response_size"])
+		assert.Equal(t, int64(200), fields["status"])
+	}
+}
+
+func TestHandler_combined(t *testing.T) {
+	entries := serve(Options{Format: FormatCombined}, newRequest("POST", "http://127.0.0.1/users/1?x=1", "data"))
+	if assert.Equal(t, 1, entries.Len()) {
+		msg := entries.All()[0].Message
+		assert.Regexp(t, `^10\.0\.0\.1 - 100 \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /users/1\?x=1 HTTP/1.1" 200 7 "http://example.com" "test-agent"$`, msg)
+		assert.Nil(t, entries.All()[0].ContextMap()["status"])
+	}
+}
+
+func TestHandler_exclude(t *testing.T) {
+	entries := serve(Options{Exclude: []string{"/healthcheck"}}, newRequest("GET", "http://127.0.0.1/healthcheck", ""))
+	assert.Equal(t, 0, entries.Len())
+	entries = serve(Options{Exclude: []string{"/healthcheck"}}, newRequest("POST", "http://127.0.0.1/users/1", ""))
+	assert.Equal(t, 1, entries.Len())
+}
+
+func TestHandler_sampling(t *testing.T) {
+	options := Options{SampleRate: 0.000001}
+	assert.Equal(t, 0, serve(options, newRequest("GET", "http://127.0.0.1/healthcheck", "")).Len())
+	// failed requests are always logged
+	assert.Equal(t, 1, serve(options, newRequest("GET", "http://127.0.0.1/unknown", "")).Len())
+}
+
+func TestHandler_slow(t *testing.T) {
+	entries := serve(Options{SlowThreshold: 10 * time.Millisecond, SampleRate: 0.000001}, newRequest("GET", "http://127.0.0.1/slow", ""))
+	if assert.Equal(t, 1, entries.Len()) {
+		e := entries.All()[0]
+		assert.Equal(t, zapcore.WarnLevel, e.Level)
+		assert.Equal(t, "slow request: GET /slow HTTP/1.1 200 2", e.Message)
+		assert.Equal(t, true, e.ContextMap()["slow"])
+		assert.Equal(t, "/slow", e.ContextMap()["route"])
+	}
+	entries = serve(Options{SlowThreshold: time.Second}, newRequest("GET", "http://127.0.0.1/slow", ""))
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, zapcore.InfoLevel, entries.All()[0].Level)
+	}
+}
+
+func TestHandler_invalidOptions(t *testing.T) {
+	logger, _ := log.NewForTest()
+	assert.Panics(t, func() {
+		Handler(logger, Options{TrustedProxies: []string{"abc"}})
+	})
+	assert.Panics(t, func() {
+		Handler(logger, Options{Exclude: []string{"healthcheck"}})
+	})
+}
+
+func TestAddFields(t *testing.T) {
+	logger, entries := log.NewForTest()
+	router := routing.New()
+	router.Use(Handler(logger, Options{SampleRate: 0.000001}))
+	router.Get("/users", func(c *routing.Context) error {
+		AddFields(c.Request.Context(), "note", "test")
+		return c.Write("OK")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://127.0.0.1/users", ""))
+	// the requests with additional fields are not sampled out
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, "test", entries.All()[0].ContextMap()["note"])
+	}
+
+	// no-op without the middleware
+	AddFields(context.Background(), "note", "test")
+}
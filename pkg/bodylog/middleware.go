@@ -0,0 +1,240 @@
+// Package bodylog provides a middleware that captures the bodies of requests and responses for debugging.
+package bodylog
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Header is the request header which turns on the capturing of a request when its value is the capture token.
+	Header = "X-Debug-Capture"
+	// DefaultMaxSize is the default maximum number of bytes captured from each body.
+	DefaultMaxSize = 4096
+)
+
+// Options represents the options of the body capturing middleware.
+type Options struct {
+	// Routes lists the route patterns (see routematch.New) of the requests whose bodies are always captured.
+	Routes []string
+	// Token is the value of the X-Debug-Capture header which turns on the capturing of a single request.
+	// The header is ignored if the token is empty.
+	Token string
+	// MaxSize is the maximum number of bytes captured from each body. Longer bodies are truncated.
+	// Defaults to DefaultMaxSize.
+	MaxSize int
+	// Redactor redacts the sensitive data in the captured bodies. Defaults to a redactor using the default rules.
+	Redactor *log.Redactor
+	// Output is where the captured bodies are written to as JSON lines, such as a rotating log file.
+	// If nil, the captured bodies are added to the access log message of the request (see accesslog.AddFields).
+	Output io.Writer
+}
+
+// Handler returns a middleware that captures the bodies of the requests matching the given routes or carrying
+// the X-Debug-Capture header with the capture token, as well as the bodies of their responses.
+//
+// Only textual bodies, such as JSON, XML, form or plain text bodies, are captured. Binary, multipart and streaming
+// bodies are skipped. The captured bodies are truncated to the maximum size and have their sensitive data redacted.
+// The middleware should be installed after accesslog.Handler and before the error handler so that error responses
+// are captured too.
+//
+// The middleware panics if the options contain an invalid route pattern.
+func Handler(options Options) routing.Handler {
+	routes, err := routematch.New(options.Routes...)
+	if err != nil {
+		panic(err)
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultMaxSize
+	}
+	if options.Redactor == nil {
+		options.Redactor, _ = log.NewRedactor(nil, nil)
+	}
+	var mu sync.Mutex
+
+	return func(c *routing.Context) error {
+		if !enabled(c.Request, routes, options.Token) {
+			return nil
+		}
+
+		var reqBody *capture
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			reqBody = &capture{skipped: !textual(c.Request.Header.Get("Content-Type"))}
+			if !reqBody.skipped {
+				// read ahead the captured part of the body and leave the rest to the handler
+				data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, int64(options.MaxSize)+1))
+				if err != nil {
+					return err
+				}
+				reqBody.write(data, options.MaxSize)
+				c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(data), c.Request.Body), c.Request.Body}
+			}
+		}
+		rw := &responseWriter{ResponseWriter: c.Response, maxSize: options.MaxSize}
+		c.Response = rw
+
+		err := c.Next()
+
+		r := record{
+			Time:      time.Now().Format(time.RFC3339),
+			RequestID: log.RequestID(c.Request.Context()),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Request:   reqBody.result(options.Redactor),
+			Response:  rw.body.result(options.Redactor),
+		}
+		if options.Output == nil {
+			r.attach(c.Request.Context())
+			return err
+		}
+		data, e := json.Marshal(r)
+		if e == nil {
+			mu.Lock()
+			_, _ = options.Output.Write(append(data, '\n'))
+			mu.Unlock()
+		}
+		return err
+	}
+}
+
+// enabled checks if the bodies of the given request should be captured.
+func enabled(req *http.Request, routes *routematch.Matcher, token string) bool {
+	if _, ok := routes.Match(req.Method, req.URL.Path); ok {
+		return true
+	}
+	value := req.Header.Get(Header)
+	return token != "" && value != "" && subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
+
+// textual checks if a body of the given content type is text that can be captured.
+func textual(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case t == "text/event-stream":
+		return false
+	case strings.HasPrefix(t, "text/"),
+		t == "application/json", strings.HasSuffix(t, "+json"),
+		t == "application/xml", strings.HasSuffix(t, "+xml"),
+		t == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+// capture holds the captured part of a body.
+type capture struct {
+	data      []byte
+	truncated bool
+	skipped   bool
+}
+
+// write captures the given data up to the maximum size.
+func (c *capture) write(data []byte, maxSize int) {
+	if n := maxSize - len(c.data); n < len(data) {
+		data = data[:n]
+		c.truncated = true
+	}
+	c.data = append(c.data, data...)
+}
+
+// result returns the redacted text of the captured body, or a placeholder if it is not captured.
+func (c *capture) result(redactor *log.Redactor) *body {
+	if c == nil {
+		return nil
+	}
+	data := c.data
+	if c.truncated {
+		// drop the multi-byte character split by the truncation, if any
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if c.skipped || !utf8.Valid(data) {
+		return &body{Skipped: true}
+	}
+	return &body{Body: redactor.RedactJSON(string(data)), Truncated: c.truncated}
+}
+
+// body represents a captured body.
+type body struct {
+	Body      string `json:"body,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"`
+}
+
+// record represents the bodies captured from a request and its response.
+type record struct {
+	Time      string `json:"time"`
+	RequestID string `json:"request_id,omitempty"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Request   *body  `json:"request,omitempty"`
+	Response  *body  `json:"response,omitempty"`
+}
+
+// attach adds the captured bodies to the access log message of the request.
+func (r record) attach(ctx context.Context) {
+	for i, b := range []*body{r.Request, r.Response} {
+		name := [...]string{"request_body", "response_body"}[i]
+		switch {
+		case b == nil:
+		case b.Skipped:
+			accesslog.AddFields(ctx, name, "[skipped]")
+		case b.Truncated:
+			accesslog.AddFields(ctx, name, b.Body, name+"_truncated", true)
+		default:
+			accesslog.AddFields(ctx, name, b.Body)
+		}
+	}
+}
+
+// readCloser reads the rest of a request body after its captured part, and closes the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseWriter captures the body of a response while writing it.
+type responseWriter struct {
+	http.ResponseWriter
+	maxSize int
+	body    *capture
+}
+
+// Write captures the written data before writing it to the wrapped response writer.
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.body == nil {
+		w.body = &capture{skipped: !textual(w.Header().Get("Content-Type"))}
+	}
+	if !w.body.skipped && !w.body.truncated {
+		w.body.write(data, w.maxSize)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends the buffered data to the client if one of the wrapped response writers supports it.
+func (w *responseWriter) Flush() {
+	accesslog.Flush(w.ResponseWriter)
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
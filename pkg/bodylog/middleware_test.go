@@ -0,0 +1,164 @@
+package bodylog
+
+import (
+	"bytes"
+	"encoding/json"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest/observer"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve processes a request by a router using the access log and body capturing middlewares with the given options.
+func serve(options Options, req *http.Request) (*httptest.ResponseRecorder, *observer.ObservedLogs) {
+	logger, entries := log.NewForTest()
+	router := routing.New()
+	router.Use(accesslog.Handler(logger, accesslog.Options{}), Handler(options))
+	router.Post("/users", func(c *routing.Context) error {
+		data, _ := ioutil.ReadAll(c.Request.Body)
+		c.Response.Header().Set("Content-Type", "application/json")
+		return c.Write(data)
+	})
+	router.Post("/files", func(c *routing.Context) error {
+		_, _ = ioutil.ReadAll(c.Request.Body)
+		c.Response.Header().Set("Content-Type", "application/octet-stream")
+		return c.Write([]byte{0xff, 0xfe})
+	})
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res, entries
+}
+
+func newRequest(url, contentType, body string) *http.Request {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestHandler(t *testing.T) {
+	body := `{"name":"demo","password":"pass"}`
+	res, entries := serve(Options{Routes: []string{"POST /users"}}, newRequest("http://127.0.0.1/users", "application/json", body))
+	assert.Equal(t, body, res.Body.String())
+	if assert.Equal(t, 1, entries.Len()) {
+		fields := entries.All()[0].ContextMap()
+		assert.Equal(t, `{"name":"demo","password":"[REDACTED]"}`, fields["request_body"])
+		assert.Equal(t, `{"name":"demo","password":"[REDACTED]"}`, fields["response_body"])
+	}
+
+	// the requests not matching the routes are not captured
+	_, entries = serve(Options{Routes: []string{"GET /users"}}, newRequest("http://127.0.0.1/users", "application/json", body))
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Nil(t, entries.All()[0].ContextMap()["request_body"])
+	}
+}
+
+func TestHandler_token(t *testing.T) {
+	req := newRequest("http://127.0.0.1/users", "application/json", `{"name":"demo"}`)
+	req.Header.Set(Header, "secret")
+	_, entries := serve(Options{Token: "secret"}, req)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, `{"name":"demo"}`, entries.All()[0].ContextMap()["request_body"])
+	}
+
+	req = newRequest("http://127.0.0.1/users", "application/json", `{"name":"demo"}`)
+	req.Header.Set(Header, "wrong")
+	_, entries = serve(Options{Token: "secret"}, req)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Nil(t, entries.All()[0].ContextMap()["request_body"])
+	}
+
+	// the header is ignored without a token
+	req = newRequest("http://127.0.0.1/users", "application/json", `{"name":"demo"}`)
+	req.Header.Set(Header, "")
+	_, entries = serve(Options{}, req)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Nil(t, entries.All()[0].ContextMap()["request_body"])
+	}
+}
+
+func TestHandler_truncated(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", 20) + `"}`
+	res, entries := serve(Options{Routes: []string{"POST /users"}, MaxSize: 10}, newRequest("http://127.0.0.1/users", "application/json", body))
+	// the handler still receives the whole body
+	assert.Equal(t, body, res.Body.String())
+	if assert.Equal(t, 1, entries.Len()) {
+		fields := entries.All()[0].ContextMap()
+		assert.Equal(t, `{"name":"a`, fields["request_body"])
+		assert.Equal(t, true, fields["request_body_truncated"])
+		assert.Equal(t, `{"name":"a`, fields["response_body"])
+	}
+}
+
+func TestHandler_skipped(t *testing.T) {
+	_, entries := serve(Options{Routes: []string{"POST /files"}}, newRequest("http://127.0.0.1/files", "multipart/form-data; boundary=x", "--x--"))
+	if assert.Equal(t, 1, entries.Len()) {
+		fields := entries.All()[0].ContextMap()
+		assert.Equal(t, "[skipped]", fields["request_body"])
+		assert.Equal(t, "[skipped]", fields["response_body"])
+	}
+}
+
+func TestHandler_output(t *testing.T) {
+	var buf bytes.Buffer
+	req := newRequest("http://127.0.0.1/users", "application/json", `{"email":"demo@example.com"}`)
+	req.Header.Set("X-Request-ID", "abc")
+	_, entries := serve(Options{Routes: []string{"POST /users"}, Output: &buf}, req)
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Nil(t, entries.All()[0].ContextMap()["request_body"])
+	}
+	var r record
+	if assert.Nil(t, json.Unmarshal(buf.Bytes(), &r)) {
+		assert.Equal(t, "abc", r.RequestID)
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/users", r.Path)
+		assert.Equal(t, `{"email":"[REDACTED]"}`, r.Request.Body)
+		assert.Equal(t, `{"email":"[REDACTED]"}`, r.Response.Body)
+	}
+}
+
+func TestHandler_invalidOptions(t *testing.T) {
+	assert.Panics(t, func() {
+		Handler(Options{Routes: []string{"users"}})
+	})
+}
+
+func TestHandler_flush(t *testing.T) {
+	// the streamed responses are flushed through the access log writer, which cannot flush by itself
+	logger, _ := log.NewForTest()
+	router := routing.New()
+	router.Use(accesslog.Handler(logger, accesslog.Options{}), Handler(Options{Routes: []string{"GET /stream"}}))
+	flushed := false
+	router.Get("/stream", func(c *routing.Context) error {
+		c.Response.Header().Set("Content-Type", "text/event-stream")
+		_, _ = c.Response.Write([]byte(": heartbeat\n\n"))
+		f, ok := c.Response.(http.Flusher)
+		if assert.True(t, ok) {
+			f.Flush()
+		}
+		flushed = true
+		return nil
+	})
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/stream", nil)
+	router.ServeHTTP(res, req)
+	assert.True(t, flushed)
+	assert.True(t, res.Flushed)
+}
+
+func Test_textual(t *testing.T) {
+	assert.True(t, textual("application/json; charset=UTF-8"))
+	assert.True(t, textual("application/problem+json"))
+	assert.True(t, textual("text/plain"))
+	assert.True(t, textual("application/x-www-form-urlencoded"))
+	assert.False(t, textual("multipart/form-data; boundary=x"))
+	assert.False(t, textual("application/octet-stream"))
+	assert.False(t, textual("image/png"))
+	assert.False(t, textual("text/event-stream"))
+	assert.False(t, textual(""))
+}
@@ -0,0 +1,63 @@
+// Package buildinfo provides the information about how the application binary was built.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Info represents the build information of the application binary.
+type Info struct {
+	// Version is the version of the application.
+	Version string `json:"version"`
+	// Commit is the git commit the binary was built from.
+	Commit string `json:"commit,omitempty"`
+	// BuildTime is the time of the build, or of the commit if the build time is unknown.
+	BuildTime string `json:"build_time,omitempty"`
+	// Dirty indicates whether the working tree had uncommitted changes when the binary was built.
+	Dirty bool `json:"dirty"`
+	// GoVersion is the version of Go the binary was built with.
+	GoVersion string `json:"go_version"`
+	// Dependencies maps the paths of the module dependencies to their versions.
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// Read returns the build information of the running binary.
+//
+// The commit, build time and dirty flag are taken from the version control information embedded by the Go toolchain
+// (see debug.ReadBuildInfo) unless the commit and build time are given, such as those injected via ldflags.
+// The version control information is only embedded when building a package rather than a list of files.
+func Read(version, commit, buildTime string) Info {
+	info := Info{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.BuildTime = s.Value
+			case "vcs.modified":
+				info.Dirty = s.Value == "true"
+			}
+		}
+		if len(bi.Deps) > 0 {
+			info.Dependencies = map[string]string{}
+		}
+		for _, dep := range bi.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			info.Dependencies[dep.Path] = dep.Version
+		}
+	}
+	if commit != "" {
+		info.Commit = commit
+	}
+	if buildTime != "" {
+		info.BuildTime = buildTime
+	}
+	return info
+}
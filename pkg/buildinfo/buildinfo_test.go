@@ -0,0 +1,18 @@
+package buildinfo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	info := Read("1.0.0", "", "")
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.NotEmpty(t, info.Dependencies)
+
+	info = Read("1.0.0", "abc", "2020-01-01T00:00:00Z")
+	assert.Equal(t, "abc", info.Commit)
+	assert.Equal(t, "2020-01-01T00:00:00Z", info.BuildTime)
+}
@@ -0,0 +1,23 @@
+// Package cache provides the stores of cached values: an in-process LRU store and a Redis store that can be shared
+// by multiple server instances.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Store.Get when the value of a key is not cached or has expired.
+var ErrMiss = errors.New("cache miss")
+
+// Store keeps values by keys for limited periods of time.
+type Store interface {
+	// Get returns the value cached for the given key, or ErrMiss if there is none.
+	// The value returned must not be modified.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set caches the value of the given key for the given period of time.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the values of the given keys. Keys that are not cached are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
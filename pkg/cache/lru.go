@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// lruStore keeps at most a fixed number of values in memory, evicting the least recently used value when full.
+// It is safe for concurrent use.
+type lruStore struct {
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// lruEntry is an element of the recently used list of the LRU store.
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRU creates a new store that keeps at most the given number of values in memory. Because the values are not
+// shared, each server instance must remove the values changed by the others, such as when notified about the changes.
+func NewLRU(size int) Store {
+	if size < 1 {
+		size = 1
+	}
+	return &lruStore{size: size, now: time.Now, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Get returns the value cached for the given key and marks it as the most recently used.
+func (s *lruStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	entry := e.Value.(*lruEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(e)
+		return nil, ErrMiss
+	}
+	s.order.MoveToFront(e)
+	return entry.value, nil
+}
+
+// Set caches the value of the given key, evicting the least recently used value if the store is full.
+func (s *lruStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &lruEntry{key, value, s.now().Add(ttl)}
+	if e, ok := s.entries[key]; ok {
+		e.Value = entry
+		s.order.MoveToFront(e)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Delete removes the values of the given keys.
+func (s *lruStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if e, ok := s.entries[key]; ok {
+			s.remove(e)
+		}
+	}
+	return nil
+}
+
+// remove removes an element from the store. The caller must hold the lock.
+func (s *lruStore) remove(e *list.Element) {
+	s.order.Remove(e)
+	delete(s.entries, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	testStore(t, NewLRU(10))
+}
+
+func TestLRU_evict(t *testing.T) {
+	s := NewLRU(2)
+	ctx := context.Background()
+	_ = s.Set(ctx, "k1", []byte("v1"), time.Hour)
+	_ = s.Set(ctx, "k2", []byte("v2"), time.Hour)
+	// k1 becomes the most recently used
+	_, _ = s.Get(ctx, "k1")
+	_ = s.Set(ctx, "k3", []byte("v3"), time.Hour)
+
+	_, err := s.Get(ctx, "k2")
+	assert.Equal(t, ErrMiss, err)
+	value, err := s.Get(ctx, "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	value, err = s.Get(ctx, "k3")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", string(value))
+	assert.Equal(t, 2, len(s.(*lruStore).entries))
+}
+
+func TestLRU_expire(t *testing.T) {
+	s := NewLRU(10).(*lruStore)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	_ = s.Set(ctx, "k1", []byte("v1"), time.Minute)
+
+	now = now.Add(59 * time.Second)
+	_, err := s.Get(ctx, "k1")
+	assert.Nil(t, err)
+	now = now.Add(time.Second)
+	_, err = s.Get(ctx, "k1")
+	assert.Equal(t, ErrMiss, err)
+	assert.Equal(t, 0, len(s.entries))
+}
+
+// testStore verifies the behavior that every Store implementation should have.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	// miss
+	_, err := s.Get(ctx, "k1")
+	assert.Equal(t, ErrMiss, err)
+
+	// set
+	assert.Nil(t, s.Set(ctx, "k1", []byte("v1"), time.Hour))
+	assert.Nil(t, s.Set(ctx, "k2", []byte("v2"), time.Hour))
+	value, err := s.Get(ctx, "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+
+	// overwrite
+	assert.Nil(t, s.Set(ctx, "k1", []byte("v1b"), time.Hour))
+	value, err = s.Get(ctx, "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1b", string(value))
+
+	// delete
+	assert.Nil(t, s.Delete(ctx, "k1", "unknown"))
+	assert.Nil(t, s.Delete(ctx))
+	_, err = s.Get(ctx, "k1")
+	assert.Equal(t, ErrMiss, err)
+	value, err = s.Get(ctx, "k2")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(value))
+}
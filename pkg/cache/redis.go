@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// redisStore keeps the values in Redis, so that they are shared by the server instances using the same Redis.
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedis creates a new store that keeps the values in Redis under keys with the given prefix, such as "api:".
+func NewRedis(client redis.UniversalClient, prefix string) Store {
+	return redisStore{client, prefix}
+}
+
+// Get returns the value cached for the given key.
+func (s redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+// Set caches the value of the given key. Redis expires the value after the given period of time.
+func (s redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+// Delete removes the values of the given keys.
+func (s redisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
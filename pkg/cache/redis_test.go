@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newTestRedis starts an in-process stand-in of Redis and returns a client connected to it.
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+func TestRedis(t *testing.T) {
+	mr, client := newTestRedis(t)
+	testStore(t, NewRedis(client, "test:"))
+	assert.True(t, mr.Exists("test:k2"))
+	assert.False(t, mr.Exists("k2"))
+}
+
+func TestRedis_expire(t *testing.T) {
+	mr, client := newTestRedis(t)
+	s := NewRedis(client, "test:")
+	ctx := context.Background()
+	assert.Nil(t, s.Set(ctx, "k1", []byte("v1"), time.Minute))
+
+	mr.FastForward(59 * time.Second)
+	_, err := s.Get(ctx, "k1")
+	assert.Nil(t, err)
+	mr.FastForward(time.Second)
+	_, err = s.Get(ctx, "k1")
+	assert.Equal(t, ErrMiss, err)
+}
+
+func TestRedis_error(t *testing.T) {
+	mr, client := newTestRedis(t)
+	s := NewRedis(client, "test:")
+	mr.Close()
+	_, err := s.Get(context.Background(), "k1")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrMiss, err)
+}
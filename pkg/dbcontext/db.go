@@ -4,14 +4,19 @@ package dbcontext
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 )
 
 // DB represents a DB connection that can be used to run SQL queries.
+// It may route the read-only queries to read replicas (see ReplicaHandler).
 type DB struct {
-	db *dbx.DB
+	db       *dbx.DB
+	replicas []*replica
+	next     uint32
 }
 
 // TransactionFunc represents a function that will start a transaction and run the given function.
@@ -21,11 +26,20 @@ type contextKey int
 
 const (
 	txKey contextKey = iota
+	sessionKey
+	primaryKey
+	retryKey
+	timeoutsKey
 )
 
-// New returns a new DB connection that wraps the given dbx.DB instance.
-func New(db *dbx.DB) *DB {
-	return &DB{db}
+// New returns a new DB connection that wraps the given dbx.DB instance of the primary database
+// and those of its read replicas, if any.
+func New(db *dbx.DB, replicas ...*dbx.DB) *DB {
+	dbc := &DB{db: db}
+	for _, r := range replicas {
+		dbc.replicas = append(dbc.replicas, &replica{db: r, healthy: 1})
+	}
+	return dbc
 }
 
 // DB returns the dbx.DB wrapped by this object.
@@ -35,30 +49,106 @@ func (db *DB) DB() *dbx.DB {
 
 // With returns a Builder that can be used to build and execute SQL queries.
 // With will return the transaction if it is found in the given context.
-// Otherwise it will return a DB connection associated with the context.
+// Otherwise it will return a DB connection associated with the context. If the context comes from
+// ReplicaHandler, the read-only queries built by the connection are run by a replica until the request writes.
+// If the context comes from WithTimeouts, the queries are run with the timeouts.
 func (db *DB) With(ctx context.Context) dbx.Builder {
-	if tx, ok := ctx.Value(txKey).(*dbx.Tx); ok {
-		return tx
+	if t, ok := ctx.Value(txKey).(*transaction); ok {
+		return t.tx
+	}
+	if s, ok := ctx.Value(sessionKey).(*session); ok && !s.isSticky() && ctx.Value(primaryKey) == nil {
+		if r := db.replica(); r != nil {
+			return &routingBuilder{Builder: builder(ctx, db.db), replica: builder(ctx, r.db), session: s}
+		}
 	}
-	return db.db.WithContext(ctx)
+	return builder(ctx, db.db)
+}
+
+// TxOptions represents the options of a transaction started by TransactionalWithOptions.
+type TxOptions struct {
+	// the isolation level and the read-only mode of the transaction
+	sql.TxOptions
+	// MaxRetries is the maximum number of times the transaction is retried when it fails because of
+	// a serialization failure or a deadlock. Zero means no retry.
+	MaxRetries int
 }
 
 // Transactional starts a transaction and calls the given function with a context storing the transaction.
 // The transaction associated with the context can be accesse via With().
+// The queries of the request made after the transaction are run by the primary database.
+//
+// If the context already stores a transaction, such as when a service method calling Transactional is called
+// within the transaction of another, the function is run within a savepoint of that transaction. If the function
+// fails, only the changes it made are rolled back and the outer transaction can continue.
 func (db *DB) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
-	return db.db.TransactionalContext(ctx, nil, func(tx *dbx.Tx) error {
-		return f(context.WithValue(ctx, txKey, tx))
-	})
+	return db.TransactionalWithOptions(ctx, TxOptions{}, f)
+}
+
+// TransactionalWithOptions is like Transactional but starts the transaction with the given options.
+//
+// If the transaction fails because of a serialization failure or a deadlock (SQLSTATE 40001 or 40P01), it is rolled
+// back and the function is called again in a new transaction, up to MaxRetries times, after a random delay which
+// grows with each attempt. The function must be safe to repeat: it should only change the database via the
+// transaction. If it has effects outside of the transaction, such as calling another service, it should call
+// NoRetry so that the transaction is not retried, or defer the effects via OnCommit.
+//
+// If the context already stores a transaction, the function is run within a savepoint of that transaction instead,
+// and the options are ignored (see Transactional).
+func (db *DB) TransactionalWithOptions(ctx context.Context, opts TxOptions, f func(ctx context.Context) error) error {
+	if t, ok := ctx.Value(txKey).(*transaction); ok {
+		return t.savepoint(ctx, f)
+	}
+	if s, ok := ctx.Value(sessionKey).(*session); ok {
+		s.stick()
+	}
+	for attempt := 0; ; attempt++ {
+		r := &retry{}
+		t := &transaction{}
+		err := db.db.TransactionalContext(ctx, &opts.TxOptions, func(tx *dbx.Tx) error {
+			t.tx = tx
+			if err := db.applyTimeouts(ctx, tx); err != nil {
+				return err
+			}
+			return f(context.WithValue(context.WithValue(ctx, txKey, t), retryKey, r))
+		})
+		if err == nil {
+			t.committed()
+			return nil
+		}
+		if attempt >= opts.MaxRetries || !r.repeatable() || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay(attempt)):
+		}
+	}
 }
 
 // TransactionHandler returns a middleware that starts a transaction.
 // The transaction started is kept in the context and can be accessed via With().
 func (db *DB) TransactionHandler() routing.Handler {
+	return db.TransactionHandlerWithOptions(sql.TxOptions{})
+}
+
+// TransactionHandlerWithOptions is like TransactionHandler but starts the transaction with the given options.
+// Unlike TransactionalWithOptions, the transaction is never retried because the response may have been sent.
+func (db *DB) TransactionHandlerWithOptions(opts sql.TxOptions) routing.Handler {
 	return func(c *routing.Context) error {
-		return db.db.TransactionalContext(c.Request.Context(), nil, func(tx *dbx.Tx) error {
-			ctx := context.WithValue(c.Request.Context(), txKey, tx)
+		t := &transaction{}
+		err := db.db.TransactionalContext(c.Request.Context(), &opts, func(tx *dbx.Tx) error {
+			t.tx = tx
+			if err := db.applyTimeouts(c.Request.Context(), tx); err != nil {
+				return err
+			}
+			ctx := context.WithValue(c.Request.Context(), txKey, t)
 			c.Request = c.Request.WithContext(ctx)
 			return c.Next()
 		})
+		if err == nil {
+			t.committed()
+		}
+		return err
 	}
 }
@@ -3,14 +3,16 @@ package dbcontext
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
-	_ "github.com/lib/pq" // initialize posgresql for test
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 const DSN = "postgres://127.0.0.1/go_restful?sslmode=disable&user=postgres&password=postgres"
@@ -103,6 +105,118 @@ func TestDB_TransactionHandler(t *testing.T) {
 	})
 }
 
+func TestDB_TransactionalWithOptions(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		dbc := New(db)
+		opts := TxOptions{TxOptions: sql.TxOptions{Isolation: sql.LevelSerializable}, MaxRetries: 2}
+
+		// retried on serialization failures
+		attempts := 0
+		err := dbc.TransactionalWithOptions(context.Background(), opts, func(ctx context.Context) error {
+			attempts++
+			_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": fmt.Sprint(attempts), "name": "name1"}).Execute()
+			assert.Nil(t, err)
+			if attempts < 2 {
+				return &pq.Error{Code: "40001"}
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, 1, runCountQuery(t, db))
+
+		// up to the maximum number of retries
+		attempts = 0
+		err = dbc.TransactionalWithOptions(context.Background(), opts, func(ctx context.Context) error {
+			attempts++
+			return &pq.Error{Code: "40P01"}
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 3, attempts)
+
+		// not retried if unsafe to repeat
+		attempts = 0
+		err = dbc.TransactionalWithOptions(context.Background(), opts, func(ctx context.Context) error {
+			attempts++
+			NoRetry(ctx)
+			return &pq.Error{Code: "40001"}
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, attempts)
+
+		// read-only transaction
+		opts = TxOptions{TxOptions: sql.TxOptions{ReadOnly: true}}
+		err = dbc.TransactionalWithOptions(context.Background(), opts, func(ctx context.Context) error {
+			_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "10", "name": "name1"}).Execute()
+			return err
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, runCountQuery(t, db))
+	})
+}
+
+func TestDB_Transactional_nested(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		dbc := New(db)
+		var committed []string
+
+		err := dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "1", "name": "name1"}).Execute()
+			assert.Nil(t, err)
+			OnCommit(ctx, func() { committed = append(committed, "outer") })
+
+			// the failed inner transaction is rolled back to its savepoint
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "2", "name": "name2"}).Execute()
+				assert.Nil(t, err)
+				OnCommit(ctx, func() { committed = append(committed, "failed") })
+				return sql.ErrNoRows
+			})
+			assert.Equal(t, sql.ErrNoRows, err)
+
+			// the successful inner transaction is kept
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "3", "name": "name3"}).Execute()
+				assert.Nil(t, err)
+				OnCommit(ctx, func() { committed = append(committed, "inner") })
+				return nil
+			})
+			assert.Nil(t, err)
+			assert.Empty(t, committed)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, runCountQuery(t, db))
+		assert.Equal(t, []string{"outer", "inner"}, committed)
+
+		// the hooks are not called if the outer transaction is rolled back
+		committed = nil
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			_ = dbc.Transactional(ctx, func(ctx context.Context) error {
+				OnCommit(ctx, func() { committed = append(committed, "inner") })
+				return nil
+			})
+			return sql.ErrNoRows
+		})
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Empty(t, committed)
+	})
+}
+
+func TestWithTimeouts(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		dbc := New(db)
+		ctx := WithTimeouts(context.Background(), 2*time.Second, 0)
+		err := dbc.Transactional(ctx, func(ctx context.Context) error {
+			var timeout string
+			err := dbc.With(ctx).NewQuery("SHOW statement_timeout").Row(&timeout)
+			assert.Equal(t, "2s", timeout)
+			return err
+		})
+		assert.Nil(t, err)
+	})
+}
+
 func runDBTest(t *testing.T, f func(db *dbx.DB)) {
 	dsn, ok := os.LookupEnv("APP_DSN")
 	if !ok {
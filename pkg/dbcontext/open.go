@@ -0,0 +1,150 @@
+package dbcontext
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// minConnectDelay is the delay before retrying to connect to the database for the first time.
+	minConnectDelay = 500 * time.Millisecond
+	// maxConnectDelay is the maximum delay before retrying to connect to the database.
+	maxConnectDelay = 5 * time.Second
+)
+
+// Options represents the options of the database connection pool. The pool options that are zero leave
+// the defaults of database/sql: no limit of open connections, two idle connections and no connection lifetime.
+type Options struct {
+	// Driver is the name of the database driver: "postgres" or "sqlite3". Defaults to "postgres".
+	Driver string
+	// MaxOpenConns is the maximum number of open connections. Zero means no limit.
+	MaxOpenConns int
+	// MaxIdleConns is the maximum number of idle connections kept in the pool.
+	MaxIdleConns int
+	// ConnMaxLifetime is the maximum amount of time a connection may be reused.
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime is the maximum amount of time a connection may be idle before it is closed.
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout is the time allowed for connecting to the database, during which failed attempts are retried.
+	// Zero means a single attempt.
+	ConnectTimeout time.Duration
+	// StatementTimeout is the default statement_timeout of the PostgreSQL sessions. Zero means no timeout.
+	StatementTimeout time.Duration
+	// LockTimeout is the default lock_timeout of the PostgreSQL sessions. Zero means no timeout.
+	LockTimeout time.Duration
+}
+
+// Open opens a PostgreSQL or SQLite database with the given DSN and options, and verifies the connection.
+//
+// The failed attempts to connect are retried with a growing delay until the connect timeout is reached, so that
+// the application can start before the database is ready. The given function, if not nil, is called to report
+// each failed attempt. The statement and lock timeouts are applied to every PostgreSQL session as run-time parameters.
+//
+// An SQLite database is accessed via a single connection that is never closed, because SQLite serializes the writes
+// anyway and an in-memory database only lives as long as its connection. The pool options are ignored.
+func Open(dsn string, options Options, logFunc func(format string, args ...interface{})) (*dbx.DB, error) {
+	if options.Driver == "" {
+		options.Driver = "postgres"
+	}
+	switch options.Driver {
+	case "postgres":
+		params := map[string]string{}
+		if options.StatementTimeout > 0 {
+			params["statement_timeout"] = fmt.Sprint(options.StatementTimeout.Milliseconds())
+		}
+		if options.LockTimeout > 0 {
+			params["lock_timeout"] = fmt.Sprint(options.LockTimeout.Milliseconds())
+		}
+		var err error
+		if dsn, err = withParams(dsn, params); err != nil {
+			return nil, err
+		}
+	case "sqlite3":
+		options.MaxOpenConns, options.MaxIdleConns, options.ConnMaxLifetime, options.ConnMaxIdleTime = 1, 1, 0, 0
+	}
+	db, err := dbx.Open(options.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(db.DB(), options)
+
+	deadline := time.Now().Add(options.ConnectTimeout)
+	for delay := minConnectDelay; ; delay *= 2 {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if options.ConnectTimeout > 0 {
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		err = db.DB().PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+		if time.Now().Add(delay).After(deadline) {
+			_ = db.Close()
+			return nil, err
+		}
+		if logFunc != nil {
+			logFunc("failed to connect to the database, retrying in %s: %v", delay, err)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// configurePool applies the pool options that are set to the given database, leaving the others as the defaults
+// of database/sql. For example, database/sql keeps two idle connections by default, while setting zero would keep none.
+func configurePool(db *sql.DB, options Options) {
+	if options.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(options.MaxOpenConns)
+	}
+	if options.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	if options.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	}
+	if options.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
+	}
+}
+
+// withParams adds the given connection parameters to a DSN in either the URL or the key-value format.
+// The parameters already in the DSN take precedence.
+func withParams(dsn string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return dsn, nil
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		for name, value := range params {
+			if q.Get(name) == "" {
+				q.Set(name, value)
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.Contains(dsn, name+"=") {
+			dsn = strings.TrimSpace(dsn + " " + name + "=" + params[name])
+		}
+	}
+	return dsn, nil
+}
@@ -0,0 +1,109 @@
+package dbcontext
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	var attempts int
+	logFunc := func(format string, args ...interface{}) {
+		attempts++
+	}
+	start := time.Now()
+	_, err := Open("postgres://127.0.0.1:1/db?sslmode=disable", Options{ConnectTimeout: time.Second}, logFunc)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// a single attempt without connect timeout
+	attempts = 0
+	_, err = Open("postgres://127.0.0.1:1/db?sslmode=disable", Options{}, logFunc)
+	assert.NotNil(t, err)
+	assert.Zero(t, attempts)
+
+	// a successful attempt with or without connect timeout
+	for _, timeout := range []time.Duration{0, time.Second} {
+		db, err := Open(":memory:", Options{Driver: "sqlite3", ConnectTimeout: timeout}, logFunc)
+		if assert.Nil(t, err, "connect timeout %v", timeout) {
+			_ = db.Close()
+		}
+	}
+	assert.Zero(t, attempts)
+}
+
+func Test_configurePool(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+
+	// the idle connections are kept unless configured otherwise
+	configurePool(db, Options{MaxOpenConns: 5})
+	assert.Nil(t, db.Ping())
+	assert.Equal(t, 5, db.Stats().MaxOpenConnections)
+	assert.Equal(t, 1, db.Stats().Idle)
+
+	configurePool(db, Options{MaxIdleConns: 1})
+	assert.Equal(t, 5, db.Stats().MaxOpenConnections)
+}
+
+func TestOpen_sqlite(t *testing.T) {
+	db, err := Open(":memory:", Options{Driver: "sqlite3", MaxOpenConns: 10, ConnMaxLifetime: time.Millisecond}, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	assert.Equal(t, 1, db.DB().Stats().MaxOpenConnections)
+
+	_, err = db.NewQuery("CREATE TABLE item (id INTEGER PRIMARY KEY)").Execute()
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	// the in-memory database is kept, the timeouts are ignored and the savepoints are supported
+	dbc := New(db)
+	ctx := WithTimeouts(context.Background(), time.Second, time.Second)
+	err = dbc.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := dbc.With(ctx).Insert("item", dbx.Params{"id": 1}).Execute(); err != nil {
+			return err
+		}
+		err := dbc.Transactional(ctx, func(ctx context.Context) error {
+			_, _ = dbc.With(ctx).Insert("item", dbx.Params{"id": 2}).Execute()
+			return errors.New("failed")
+		})
+		assert.EqualError(t, err, "failed")
+		return nil
+	})
+	assert.Nil(t, err)
+	var count int
+	assert.Nil(t, db.Select("COUNT(*)").From("item").Row(&count))
+	assert.Equal(t, 1, count)
+}
+
+func Test_withParams(t *testing.T) {
+	params := map[string]string{"statement_timeout": "30000", "lock_timeout": "10000"}
+	tests := []struct {
+		name, dsn, want string
+	}{
+		{"url", "postgres://127.0.0.1/db?sslmode=disable", "postgres://127.0.0.1/db?lock_timeout=10000&sslmode=disable&statement_timeout=30000"},
+		{"url with param", "postgres://127.0.0.1/db?statement_timeout=5000", "postgres://127.0.0.1/db?lock_timeout=10000&statement_timeout=5000"},
+		{"key-value", "host=127.0.0.1 dbname=db", "host=127.0.0.1 dbname=db lock_timeout=10000 statement_timeout=30000"},
+		{"key-value with param", "host=127.0.0.1 lock_timeout=1", "host=127.0.0.1 lock_timeout=1 statement_timeout=30000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := withParams(tt.dsn, params)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, dsn)
+		})
+	}
+	dsn, _ := withParams("postgres://127.0.0.1/db", nil)
+	assert.Equal(t, "postgres://127.0.0.1/db", dsn)
+}
@@ -0,0 +1,175 @@
+package dbcontext
+
+import (
+	"context"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// lagSQL returns the replication lag of a PostgreSQL replica in seconds. The lag is zero if the replica has replayed
+// everything it has received, so that a replica of an idle primary is not considered lagging.
+const lagSQL = `SELECT COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0)`
+
+// replica is a read replica of the primary database.
+type replica struct {
+	db      *dbx.DB
+	healthy int32
+}
+
+// session tracks whether the queries of a request must be run by the primary database.
+type session struct {
+	sticky int32
+}
+
+// stick makes the rest of the queries of the request run by the primary database.
+func (s *session) stick() {
+	atomic.StoreInt32(&s.sticky, 1)
+}
+
+// isSticky returns whether the queries of the request must be run by the primary database.
+func (s *session) isSticky() bool {
+	return atomic.LoadInt32(&s.sticky) == 1
+}
+
+// ReplicaHandler returns a middleware that allows the read-only queries of a request to be run by the read replicas.
+//
+// The queries built via With() using the request context are run by a replica, chosen in turn among the replicas
+// in rotation, as long as they are SELECT statements. Once the request writes or starts a transaction, the rest of
+// its queries are run by the primary database so that it reads its own writes. Requests processed without
+// the middleware only use the primary database.
+func (db *DB) ReplicaHandler() routing.Handler {
+	return func(c *routing.Context) error {
+		if len(db.replicas) > 0 {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), sessionKey, &session{}))
+		}
+		return nil
+	}
+}
+
+// WithPrimary returns a context whose queries are always run by the primary database, such as the context
+// of a read that must see the latest data.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// replica returns the next replica in rotation, or nil if none is.
+func (db *DB) replica() *replica {
+	n := len(db.replicas)
+	start := atomic.AddUint32(&db.next, 1)
+	for i := 0; i < n; i++ {
+		r := db.replicas[(int(start)+i)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// CheckReplicas checks the replication lag of the replicas. The replicas lagging behind the primary database by more
+// than maxLag, or failing the check, are taken out of rotation until they catch up. The given function, if not nil,
+// is called when a replica is taken out of or back into rotation.
+func (db *DB) CheckReplicas(ctx context.Context, maxLag time.Duration, logFunc func(format string, args ...interface{})) {
+	for i, r := range db.replicas {
+		var lag float64
+		// query the connection directly so that the checks are not logged as application queries
+		err := r.db.DB().QueryRowContext(ctx, lagSQL).Scan(&lag)
+		healthy := err == nil && time.Duration(lag*float64(time.Second)) <= maxLag
+		var state int32
+		if healthy {
+			state = 1
+		}
+		if atomic.SwapInt32(&r.healthy, state) == state || logFunc == nil {
+			continue
+		}
+		switch {
+		case healthy:
+			logFunc("replica %d is back in rotation", i)
+		case err != nil:
+			logFunc("replica %d is taken out of rotation: %v", i, err)
+		default:
+			logFunc("replica %d is taken out of rotation: lagging %.1fs behind", i, lag)
+		}
+	}
+}
+
+// MonitorReplicas calls CheckReplicas at the given interval until the context is done.
+func (db *DB) MonitorReplicas(ctx context.Context, interval, maxLag time.Duration, logFunc func(format string, args ...interface{})) {
+	if len(db.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		db.CheckReplicas(ctx, maxLag, logFunc)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// routingBuilder is a dbx.Builder which runs the read-only queries by a replica and the rest by the primary database.
+// It switches to the primary database for good once a write query is built.
+type routingBuilder struct {
+	dbx.Builder
+	replica dbx.Builder
+	session *session
+}
+
+// NewQuery creates a query which is run by the replica if it is a SELECT statement.
+func (b *routingBuilder) NewQuery(sql string) *dbx.Query {
+	if !b.session.isSticky() && isRead(sql) {
+		return b.replica.NewQuery(sql)
+	}
+	b.session.stick()
+	return b.Builder.NewQuery(sql)
+}
+
+// Select creates a SELECT query which is run by the replica.
+func (b *routingBuilder) Select(cols ...string) *dbx.SelectQuery {
+	if b.session.isSticky() {
+		return b.Builder.Select(cols...)
+	}
+	return b.replica.Select(cols...)
+}
+
+// Model creates a query which inserts, updates or deletes a model in the primary database.
+func (b *routingBuilder) Model(model interface{}) *dbx.ModelQuery {
+	b.session.stick()
+	return b.Builder.Model(model)
+}
+
+// Insert creates an INSERT query which is run by the primary database.
+func (b *routingBuilder) Insert(table string, cols dbx.Params) *dbx.Query {
+	b.session.stick()
+	return b.Builder.Insert(table, cols)
+}
+
+// Upsert creates an UPSERT query which is run by the primary database.
+func (b *routingBuilder) Upsert(table string, cols dbx.Params, constraints ...string) *dbx.Query {
+	b.session.stick()
+	return b.Builder.Upsert(table, cols, constraints...)
+}
+
+// Update creates an UPDATE query which is run by the primary database.
+func (b *routingBuilder) Update(table string, cols dbx.Params, where dbx.Expression) *dbx.Query {
+	b.session.stick()
+	return b.Builder.Update(table, cols, where)
+}
+
+// Delete creates a DELETE query which is run by the primary database.
+func (b *routingBuilder) Delete(table string, where dbx.Expression) *dbx.Query {
+	b.session.stick()
+	return b.Builder.Delete(table, where)
+}
+
+// isRead checks if the SQL statement is a plain SELECT statement, which does not lock rows.
+func isRead(sql string) bool {
+	s := strings.ToUpper(strings.TrimSpace(sql))
+	return strings.HasPrefix(s, "SELECT") && !strings.Contains(s, " FOR UPDATE") && !strings.Contains(s, " FOR SHARE")
+}
@@ -0,0 +1,109 @@
+package dbcontext
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// connector is a driver.Connector that never connects.
+type connector struct{}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
+
+// newReplicaTestDB returns a DB whose primary quotes names in the PostgreSQL style and whose replica quotes names
+// in the MySQL style, so that the SQL built by a query tells which database runs it.
+func newReplicaTestDB() *DB {
+	return New(dbx.NewFromDB(sql.OpenDB(connector{}), "postgres"), dbx.NewFromDB(sql.OpenDB(connector{}), "mysql"))
+}
+
+// requestContext returns the context of a request processed by the replica middleware of db.
+func requestContext(t *testing.T, db *DB) context.Context {
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/albums", nil)
+	c := routing.NewContext(httptest.NewRecorder(), req)
+	assert.Nil(t, db.ReplicaHandler()(c))
+	return c.Request.Context()
+}
+
+const (
+	primarySQL = `SELECT "id" FROM "album"`
+	replicaSQL = "SELECT `id` FROM `album`"
+)
+
+func TestDB_ReplicaHandler(t *testing.T) {
+	db := newReplicaTestDB()
+
+	// queries outside of requests are run by the primary database
+	assert.Equal(t, primarySQL, db.With(context.Background()).Select("id").From("album").Build().SQL())
+
+	ctx := requestContext(t, db)
+	assert.Equal(t, replicaSQL, db.With(ctx).Select("id").From("album").Build().SQL())
+	var queried []string
+	db.db.QueryLogFunc = func(context.Context, time.Duration, string, *sql.Rows, error) { queried = append(queried, "primary") }
+	db.replicas[0].db.QueryLogFunc = func(context.Context, time.Duration, string, *sql.Rows, error) { queried = append(queried, "replica") }
+	_ = db.With(ctx).NewQuery("SELECT id FROM album").Row()
+	_ = db.With(ctx).NewQuery("SELECT id FROM album FOR UPDATE").Row()
+	assert.Equal(t, []string{"replica", "primary"}, queried)
+
+	// a write makes the following queries of the request run by the primary database
+	ctx = requestContext(t, db)
+	builder := db.With(ctx)
+	assert.Equal(t, `INSERT INTO "album" ("id") VALUES ({:p0})`, builder.Insert("album", dbx.Params{"id": "1"}).SQL())
+	assert.Equal(t, primarySQL, builder.Select("id").From("album").Build().SQL())
+	assert.Equal(t, primarySQL, db.With(ctx).Select("id").From("album").Build().SQL())
+
+	// other requests are not affected
+	assert.Equal(t, replicaSQL, db.With(requestContext(t, db)).Select("id").From("album").Build().SQL())
+
+	// transactions make the following queries of the request run by the primary database
+	ctx = requestContext(t, db)
+	_ = db.Transactional(ctx, func(ctx context.Context) error { return nil })
+	assert.Equal(t, primarySQL, db.With(ctx).Select("id").From("album").Build().SQL())
+
+	// the primary database can be forced
+	ctx = WithPrimary(requestContext(t, db))
+	assert.Equal(t, primarySQL, db.With(ctx).Select("id").From("album").Build().SQL())
+
+	// no replica in rotation
+	ctx = requestContext(t, db)
+	db.replicas[0].healthy = 0
+	assert.Equal(t, primarySQL, db.With(ctx).Select("id").From("album").Build().SQL())
+}
+
+func TestDB_CheckReplicas(t *testing.T) {
+	db := newReplicaTestDB()
+	var messages []string
+	logFunc := func(format string, args ...interface{}) {
+		messages = append(messages, format)
+	}
+	// the replica cannot be connected
+	db.CheckReplicas(context.Background(), time.Second, logFunc)
+	assert.Nil(t, db.replica())
+	assert.Equal(t, []string{"replica %d is taken out of rotation: %v"}, messages)
+
+	// no change
+	db.CheckReplicas(context.Background(), time.Second, logFunc)
+	assert.Len(t, messages, 1)
+}
+
+func Test_isRead(t *testing.T) {
+	assert.True(t, isRead("SELECT * FROM album"))
+	assert.True(t, isRead(" select 1"))
+	assert.False(t, isRead("SELECT * FROM album FOR UPDATE"))
+	assert.False(t, isRead("INSERT INTO album (id) VALUES (1)"))
+	assert.False(t, isRead("WITH a AS (DELETE FROM album RETURNING *) SELECT * FROM a"))
+}
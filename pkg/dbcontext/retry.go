@@ -0,0 +1,57 @@
+package dbcontext
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minRetryDelay is the delay before the first retry of a transaction, which doubles with each retry.
+	minRetryDelay = 20 * time.Millisecond
+	// maxRetryDelay is the maximum delay before retrying a transaction.
+	maxRetryDelay = time.Second
+)
+
+// retry tracks whether an attempt of running a transaction can be repeated.
+type retry struct {
+	unrepeatable int32
+}
+
+// repeatable returns whether the attempt can be repeated.
+func (r *retry) repeatable() bool {
+	return atomic.LoadInt32(&r.unrepeatable) == 0
+}
+
+// NoRetry marks the transaction in the given context as unsafe to repeat, such as after it has sent a message
+// to another service, so that TransactionalWithOptions does not retry it.
+func NoRetry(ctx context.Context) {
+	if r, ok := ctx.Value(retryKey).(*retry); ok {
+		atomic.StoreInt32(&r.unrepeatable, 1)
+	}
+}
+
+// isRetryable checks if the error is a PostgreSQL serialization failure or deadlock, which can be resolved
+// by retrying the transaction.
+func isRetryable(err error) bool {
+	var e *pq.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.Code == "40001" || e.Code == "40P01"
+}
+
+// retryDelay returns the random delay before the given retry of a transaction, so that the transactions
+// conflicting with each other are not retried at the same time.
+func retryDelay(attempt int) time.Duration {
+	d := maxRetryDelay
+	if attempt < 10 {
+		if exp := minRetryDelay << uint(attempt); exp < d {
+			d = exp
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,36 @@
+package dbcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_isRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&pq.Error{Code: "40001"}))
+	assert.True(t, isRetryable(fmt.Errorf("update: %w", &pq.Error{Code: "40P01"})))
+	assert.False(t, isRetryable(&pq.Error{Code: "23505"}))
+	assert.False(t, isRetryable(errors.New("40001")))
+	assert.False(t, isRetryable(nil))
+}
+
+func Test_retryDelay(t *testing.T) {
+	for attempt, max := range []time.Duration{minRetryDelay, 2 * minRetryDelay, 4 * minRetryDelay} {
+		d := retryDelay(attempt)
+		assert.True(t, d >= max/2 && d <= max, "attempt %v: %v", attempt, d)
+	}
+	assert.True(t, retryDelay(100) <= maxRetryDelay)
+}
+
+func TestNoRetry(t *testing.T) {
+	r := &retry{}
+	assert.True(t, r.repeatable())
+	NoRetry(context.WithValue(context.Background(), retryKey, r))
+	assert.False(t, r.repeatable())
+	// no-op outside of transactions
+	NoRetry(context.Background())
+}
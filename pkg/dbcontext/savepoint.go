@@ -0,0 +1,86 @@
+package dbcontext
+
+import (
+	"context"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"sync"
+)
+
+// transaction is a transaction stored in a context, together with its savepoints and after-commit hooks.
+type transaction struct {
+	tx         *dbx.Tx
+	mu         sync.Mutex
+	savepoints int
+	hooks      []func()
+}
+
+// savepoint runs the given function within a new savepoint of the transaction. If the function fails or panics,
+// the transaction is rolled back to the savepoint, discarding the after-commit hooks added by the function.
+func (t *transaction) savepoint(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	t.mu.Lock()
+	t.savepoints++
+	name := fmt.Sprintf("sp_%d", t.savepoints)
+	hooks := len(t.hooks)
+	t.mu.Unlock()
+
+	if _, err := t.tx.NewQuery("SAVEPOINT " + name).Execute(); err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			t.rollback(name, hooks)
+			panic(e)
+		}
+		if err != nil {
+			if e := t.rollback(name, hooks); e != nil {
+				err = fmt.Errorf("%v (rollback to savepoint failed: %v)", err, e)
+			}
+			return
+		}
+		_, err = t.tx.NewQuery("RELEASE SAVEPOINT " + name).Execute()
+	}()
+	return f(ctx)
+}
+
+// rollback rolls back the transaction to the named savepoint and discards the after-commit hooks added since then.
+func (t *transaction) rollback(name string, hooks int) error {
+	t.mu.Lock()
+	t.hooks = t.hooks[:hooks]
+	t.mu.Unlock()
+	_, err := t.tx.NewQuery("ROLLBACK TO SAVEPOINT " + name).Execute()
+	return err
+}
+
+// committed runs the after-commit hooks once the transaction is committed.
+func (t *transaction) committed() {
+	t.mu.Lock()
+	hooks := t.hooks
+	t.hooks = nil
+	t.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// OnCommit registers a function to be called after the transaction in the given context is committed, such as
+// a function sending a notification about the changes made by the transaction. The function is not called
+// if the transaction, or the savepoint the function is registered within, is rolled back. If the context does not
+// store a transaction, the function is called immediately.
+func OnCommit(ctx context.Context, fn func()) {
+	t, ok := ctx.Value(txKey).(*transaction)
+	if !ok {
+		fn()
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = append(t.hooks, fn)
+}
+
+// InTransaction returns whether the given context stores a transaction, whose uncommitted changes may be seen
+// by the queries built via With().
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey).(*transaction)
+	return ok
+}
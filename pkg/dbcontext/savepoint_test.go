@@ -0,0 +1,30 @@
+package dbcontext
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOnCommit(t *testing.T) {
+	// called immediately outside of transactions
+	called := 0
+	OnCommit(context.Background(), func() { called++ })
+	assert.Equal(t, 1, called)
+
+	// called after the transaction is committed
+	tx := &transaction{}
+	ctx := context.WithValue(context.Background(), txKey, tx)
+	OnCommit(ctx, func() { called++ })
+	OnCommit(ctx, func() { called++ })
+	assert.Equal(t, 1, called)
+	tx.committed()
+	assert.Equal(t, 3, called)
+	tx.committed()
+	assert.Equal(t, 3, called)
+}
+
+func TestInTransaction(t *testing.T) {
+	assert.False(t, InTransaction(context.Background()))
+	assert.True(t, InTransaction(context.WithValue(context.Background(), txKey, &transaction{})))
+}
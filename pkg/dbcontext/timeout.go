@@ -0,0 +1,118 @@
+package dbcontext
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"time"
+)
+
+// timeouts represents the statement and lock timeouts overriding the defaults of the sessions.
+type timeouts struct {
+	statement time.Duration
+	lock      time.Duration
+}
+
+// WithTimeouts returns a context whose queries use the given statement and lock timeouts instead of the defaults
+// of the database sessions (see Options), such as the context of a request that should fail fast. A zero timeout
+// keeps the default.
+//
+// The timeouts are applied via SET LOCAL when a transaction starts. Outside of transactions, each SQL execution runs
+// in a transaction of its own so that the timeouts can be applied in the same way. A query returning rows cannot,
+// because its rows are read after it returns, so it is canceled once the statement timeout elapses instead.
+// The timeouts are ignored by SQLite databases.
+func WithTimeouts(ctx context.Context, statement, lock time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutsKey, timeouts{statement, lock})
+}
+
+// applyTimeouts sets the timeouts stored in the given context, if any, for the rest of the transaction.
+func (db *DB) applyTimeouts(ctx context.Context, tx *dbx.Tx) error {
+	t, ok := ctx.Value(timeoutsKey).(timeouts)
+	if !ok || db.db.DriverName() != "postgres" {
+		return nil
+	}
+	return t.set(func(stmt string) error {
+		_, err := tx.NewQuery(stmt).WithContext(ctx).Execute()
+		return err
+	})
+}
+
+// builder returns a Builder running the queries of the given database with the given context, and with the timeouts
+// stored in the context, if any.
+func builder(ctx context.Context, db *dbx.DB) dbx.Builder {
+	db = db.WithContext(ctx)
+	t, ok := ctx.Value(timeoutsKey).(timeouts)
+	newBuilder, supported := dbx.BuilderFuncMap[db.DriverName()]
+	if !ok || db.DriverName() != "postgres" || !supported {
+		return db
+	}
+	return newBuilder(db, &timeoutExecutor{db.DB(), t})
+}
+
+// set sets the timeouts for the rest of a transaction by executing SET LOCAL statements with the given function.
+func (t timeouts) set(exec func(stmt string) error) error {
+	for name, d := range map[string]time.Duration{"statement_timeout": t.statement, "lock_timeout": t.lock} {
+		if d <= 0 {
+			continue
+		}
+		if err := exec(fmt.Sprintf("SET LOCAL %s = %d", name, d.Milliseconds())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeoutExecutor is a dbx.Executor which runs the SQL statements outside of transactions with the given timeouts.
+type timeoutExecutor struct {
+	db       *sql.DB
+	timeouts timeouts
+}
+
+// Exec executes a SQL statement with the timeouts.
+func (e *timeoutExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a SQL statement in a transaction of its own, which applies the timeouts.
+func (e *timeoutExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = e.timeouts.set(func(stmt string) error {
+		_, err := tx.ExecContext(ctx, stmt)
+		return err
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+// Query runs a query with the statement timeout.
+func (e *timeoutExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return e.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext runs a query which is canceled once the statement timeout elapses.
+func (e *timeoutExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if e.timeouts.statement > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeouts.statement)
+		// the rows are read after the query returns, so the context is only released once it expires
+		time.AfterFunc(e.timeouts.statement, cancel)
+	}
+	return e.db.QueryContext(ctx, query, args...)
+}
+
+// Prepare creates a prepared statement.
+func (e *timeoutExecutor) Prepare(query string) (*sql.Stmt, error) {
+	return e.db.Prepare(query)
+}
@@ -0,0 +1,109 @@
+package dbcontext
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+// recorder is a driver.Connector whose connections record the statements they run.
+type recorder struct {
+	statements []string
+	deadlines  []bool
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) {
+	return recorderConn{r}, nil
+}
+
+func (r *recorder) Driver() driver.Driver {
+	return nil
+}
+
+// recorderConn is a connection of recorder.
+type recorderConn struct {
+	r *recorder
+}
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c recorderConn) Close() error {
+	return nil
+}
+
+func (c recorderConn) Begin() (driver.Tx, error) {
+	c.r.statements = append(c.r.statements, "BEGIN")
+	return c, nil
+}
+
+func (c recorderConn) Commit() error {
+	c.r.statements = append(c.r.statements, "COMMIT")
+	return nil
+}
+
+func (c recorderConn) Rollback() error {
+	c.r.statements = append(c.r.statements, "ROLLBACK")
+	return nil
+}
+
+func (c recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.r.statements = append(c.r.statements, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c recorderConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	_, ok := ctx.Deadline()
+	c.r.statements = append(c.r.statements, query)
+	c.r.deadlines = append(c.r.deadlines, ok)
+	return recorderRows{}, nil
+}
+
+// recorderRows is an empty result of recorderConn.
+type recorderRows struct{}
+
+func (recorderRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (recorderRows) Close() error {
+	return nil
+}
+
+func (recorderRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+func TestWithTimeouts_nonTransactional(t *testing.T) {
+	r := &recorder{}
+	db := New(dbx.NewFromDB(sql.OpenDB(r), "postgres"))
+	ctx := WithTimeouts(context.Background(), 2*time.Second, time.Second)
+
+	// an execution runs in a transaction of its own setting the timeouts
+	_, err := db.With(ctx).Update("album", dbx.Params{"name": "a"}, nil).Execute()
+	assert.Nil(t, err)
+	assert.Equal(t, "BEGIN", r.statements[0])
+	assert.ElementsMatch(t, []string{"SET LOCAL statement_timeout = 2000", "SET LOCAL lock_timeout = 1000"}, r.statements[1:3])
+	assert.Equal(t, []string{`UPDATE "album" SET "name"=$1`, "COMMIT"}, r.statements[3:])
+
+	// a query is canceled after the statement timeout
+	r.statements = nil
+	var ids []string
+	assert.Nil(t, db.With(ctx).Select("id").From("album").Column(&ids))
+	assert.Equal(t, []string{`SELECT "id" FROM "album"`}, r.statements)
+	assert.Equal(t, []bool{true}, r.deadlines)
+
+	// the queries without timeouts are run as usual
+	r.statements, r.deadlines = nil, nil
+	_, err = db.With(context.Background()).Update("album", dbx.Params{"name": "a"}, nil).Execute()
+	assert.Nil(t, err)
+	assert.Nil(t, db.With(context.Background()).Select("id").From("album").Column(&ids))
+	assert.Equal(t, []string{`UPDATE "album" SET "name"=$1`, `SELECT "id" FROM "album"`}, r.statements)
+	assert.Equal(t, []bool{false}, r.deadlines)
+}
@@ -0,0 +1,266 @@
+// Package fixture loads the rows of database tables declared in YAML or JSON files, such as the seed data of
+// a database or the data needed by repository tests.
+//
+// Each file is named after the table it populates, such as "album.yml" or "album_event.json", and lists the rows
+// of the table along with the tables it depends on:
+//
+//	depends_on: [album]
+//	rows:
+//	  - id: '{{uuid}}'
+//	    album_id: '{{uuid "kirk"}}'
+//	    created_at: '{{ago "2d"}}'
+//
+// String values are executed as text/template templates with the following functions:
+//
+//	uuid          a random UUID; with a name, such as uuid "kirk", the same UUID for all values using the name
+//	now           the current time
+//	ago D         the time D ago, where D is a duration such as "90m", "12h" or "7d"
+//	fromNow D     the time D from now
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TimeFormat is the format of the times produced by the template functions.
+const TimeFormat = time.RFC3339
+
+// Row represents a table row, which maps column names to values.
+type Row map[string]interface{}
+
+// Table represents the fixture of a database table.
+type Table struct {
+	// Name is the name of the table.
+	Name string `yaml:"-" json:"-"`
+	// DependsOn lists the tables that must be populated before this table, such as those referenced by its foreign keys.
+	DependsOn []string `yaml:"depends_on" json:"depends_on"`
+	// Rows lists the rows of the table.
+	Rows []Row `yaml:"rows" json:"rows"`
+}
+
+// Load reads the fixtures of the given tables from the files in the root of fsys, or those of all tables if none
+// is given. The values of the rows are rendered, and the tables are returned in dependency order.
+func Load(fsys fs.FS, tables ...string) ([]Table, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || ext != ".yml" && ext != ".yaml" && ext != ".json" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("multiple fixture files for the table %q", name)
+		}
+		files[name] = entry.Name()
+	}
+	if len(tables) == 0 {
+		for name := range files {
+			tables = append(tables, name)
+		}
+	}
+
+	r := newRenderer(time.Now())
+	var result []Table
+	for _, name := range tables {
+		file, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("no fixture file for the table %q", name)
+		}
+		table, err := read(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		table.Name = name
+		if err := r.renderRows(table.Rows); err != nil {
+			return nil, fmt.Errorf("%v: %v", file, err)
+		}
+		result = append(result, table)
+	}
+	return sortTables(result)
+}
+
+// Insert replaces the rows of the given tables with those of the fixtures. The rows are deleted in the reverse
+// order of the tables and inserted in their order, so that the tables are expected to be in dependency order.
+// To replace all rows or none, db should be a transaction.
+func Insert(ctx context.Context, db dbx.Builder, tables []Table) error {
+	for i := len(tables) - 1; i >= 0; i-- {
+		if _, err := db.Delete(tables[i].Name, nil).WithContext(ctx).Execute(); err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		for _, row := range table.Rows {
+			if _, err := db.Insert(table.Name, dbx.Params(row)).WithContext(ctx).Execute(); err != nil {
+				return fmt.Errorf("inserting into %v: %v", table.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// read reads a fixture file.
+func read(fsys fs.FS, file string) (Table, error) {
+	var table Table
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return table, err
+	}
+	if path.Ext(file) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&table)
+	} else {
+		err = yaml.Unmarshal(data, &table)
+	}
+	if err != nil {
+		return table, fmt.Errorf("%v: %v", file, err)
+	}
+	return table, nil
+}
+
+// sortTables sorts the tables in dependency order. The dependencies on tables not given are ignored.
+func sortTables(tables []Table) ([]Table, error) {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	pending := map[string]bool{}
+	for _, table := range tables {
+		pending[table.Name] = true
+	}
+	var result []Table
+	for len(result) < len(tables) {
+		n := len(result)
+		for _, table := range tables {
+			if pending[table.Name] && ready(table, pending) {
+				delete(pending, table.Name)
+				result = append(result, table)
+			}
+		}
+		if len(result) == n {
+			var names []string
+			for _, table := range tables {
+				if pending[table.Name] {
+					names = append(names, table.Name)
+				}
+			}
+			return nil, fmt.Errorf("circular dependency among the tables %v", strings.Join(names, ", "))
+		}
+	}
+	return result, nil
+}
+
+// ready checks if the dependencies of the table are no longer pending.
+func ready(table Table, pending map[string]bool) bool {
+	for _, dependency := range table.DependsOn {
+		if pending[dependency] && dependency != table.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// renderer renders the templates in the values of rows.
+type renderer struct {
+	now   time.Time
+	uuids map[string]string
+	funcs template.FuncMap
+}
+
+// newRenderer creates a renderer whose relative times are based on the given time.
+func newRenderer(now time.Time) *renderer {
+	r := &renderer{now: now.UTC().Truncate(time.Second), uuids: map[string]string{}}
+	r.funcs = template.FuncMap{
+		"uuid": r.uuid,
+		"now": func() string {
+			return r.now.Format(TimeFormat)
+		},
+		"ago": func(d string) (string, error) {
+			duration, err := parseDuration(d)
+			return r.now.Add(-duration).Format(TimeFormat), err
+		},
+		"fromNow": func(d string) (string, error) {
+			duration, err := parseDuration(d)
+			return r.now.Add(duration).Format(TimeFormat), err
+		},
+	}
+	return r
+}
+
+// renderRows renders the string values of the rows in place.
+func (r *renderer) renderRows(rows []Row) error {
+	for _, row := range rows {
+		for column, value := range row {
+			switch v := value.(type) {
+			case string:
+				s, err := r.render(v)
+				if err != nil {
+					return fmt.Errorf("column %v: %v", column, err)
+				}
+				row[column] = s
+			case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+				return fmt.Errorf("column %v: unsupported value %v", column, v)
+			}
+		}
+	}
+	return nil
+}
+
+// render executes the template in the given string, if any.
+func (r *renderer) render(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := template.New("").Funcs(r.funcs).Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// uuid returns a random UUID. If a name is given, the UUID generated for the name the first time is returned.
+func (r *renderer) uuid(name ...string) string {
+	if len(name) == 0 {
+		return uuid.New().String()
+	}
+	key := strings.Join(name, " ")
+	if _, ok := r.uuids[key]; !ok {
+		r.uuids[key] = uuid.New().String()
+	}
+	return r.uuids[key]
+}
+
+// parseDuration parses a duration as time.ParseDuration does, allowing a leading number of days such as "7d" or "1d12h".
+func parseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	if i := strings.Index(s, "d"); i >= 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		days, s = time.Duration(n)*24*time.Hour, s[i+1:]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	return days + d, err
+}
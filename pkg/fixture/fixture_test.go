@@ -0,0 +1,127 @@
+package fixture
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testFS = fstest.MapFS{
+	"album.yml": {Data: []byte(`
+rows:
+  - id: '{{uuid "kirk"}}'
+    name: KIRK
+    year: 2019
+    created_at: '{{ago "1d"}}'
+`)},
+	"album_event.json": {Data: []byte(`{
+  "depends_on": ["album"],
+  "rows": [{"seq": 1, "album_id": "{{uuid \"kirk\"}}", "type": "created"}]
+}`)},
+	"track.yaml": {Data: []byte(`
+depends_on: [album, album_event]
+rows:
+  - id: '{{uuid}}'
+    album_id: '{{uuid "kirk"}}'
+`)},
+	"README.md": {Data: []byte("fixtures")},
+}
+
+func TestLoad(t *testing.T) {
+	tables, err := Load(testFS)
+	assert.Nil(t, err)
+	if assert.Len(t, tables, 3) {
+		assert.Equal(t, "album", tables[0].Name)
+		assert.Equal(t, "album_event", tables[1].Name)
+		assert.Equal(t, "track", tables[2].Name)
+
+		id := tables[0].Rows[0]["id"]
+		assert.Len(t, id, 36)
+		assert.Equal(t, id, tables[1].Rows[0]["album_id"])
+		assert.Equal(t, id, tables[2].Rows[0]["album_id"])
+		assert.NotEqual(t, id, tables[2].Rows[0]["id"])
+		assert.Equal(t, 2019, tables[0].Rows[0]["year"])
+		createdAt, err := time.Parse(TimeFormat, tables[0].Rows[0]["created_at"].(string))
+		assert.Nil(t, err)
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), createdAt, time.Minute)
+	}
+
+	tables, err = Load(testFS, "track", "album")
+	assert.Nil(t, err)
+	if assert.Len(t, tables, 2) {
+		assert.Equal(t, "album", tables[0].Name)
+		assert.Equal(t, "track", tables[1].Name)
+	}
+
+	_, err = Load(testFS, "genre")
+	assert.NotNil(t, err)
+
+	_, err = Load(fstest.MapFS{
+		"a.yml": {Data: []byte("depends_on: [b]")},
+		"b.yml": {Data: []byte("depends_on: [a]")},
+	})
+	assert.EqualError(t, err, "circular dependency among the tables a, b")
+
+	_, err = Load(fstest.MapFS{"a.yml": {Data: []byte("rows: [{id: '{{unknown}}'}]")}})
+	assert.NotNil(t, err)
+
+	_, err = Load(fstest.MapFS{"a.yml": {Data: []byte("rows: [{id: {a: 1}}]")}})
+	assert.NotNil(t, err)
+
+	_, err = Load(fstest.MapFS{"a.yml": {Data: []byte("rows")}})
+	assert.NotNil(t, err)
+}
+
+// connector is a driver.Connector that never connects.
+type connector struct{}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
+
+func TestInsert(t *testing.T) {
+	db := dbx.NewFromDB(sql.OpenDB(connector{}), "postgres")
+	var executed []string
+	db.ExecLogFunc = func(ctx context.Context, t time.Duration, sql string, result sql.Result, err error) {
+		executed = append(executed, sql)
+	}
+	tables := []Table{
+		{Name: "album", Rows: []Row{{"id": "1"}}},
+		{Name: "track", Rows: []Row{{"id": "2"}}},
+	}
+	assert.NotNil(t, Insert(context.Background(), db, tables))
+	assert.Equal(t, []string{`DELETE FROM "track"`}, executed)
+
+	assert.Nil(t, Insert(context.Background(), db, nil))
+}
+
+func Test_parseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"xd", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		d, err := parseDuration(tt.value)
+		assert.Equal(t, tt.wantErr, err != nil, tt.value)
+		if !tt.wantErr {
+			assert.Equal(t, tt.want, d, tt.value)
+		}
+	}
+}
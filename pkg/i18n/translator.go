@@ -0,0 +1,173 @@
+// Package i18n translates messages into the languages preferred by the API clients.
+package i18n
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultLanguage is the language used when no catalog matches the languages preferred by a client.
+const DefaultLanguage = "en"
+
+// Translator translates the messages identified by stable keys using message catalogs.
+type Translator struct {
+	// catalogs maps lower-cased language tags to catalogs, which map message keys to messages.
+	catalogs map[string]map[string]string
+}
+
+// New creates a translator using the given catalogs, which are keyed by language tags such as "en" or "pt-BR".
+func New(catalogs map[string]map[string]string) *Translator {
+	t := &Translator{catalogs: map[string]map[string]string{}}
+	for lang, catalog := range catalogs {
+		t.catalogs[strings.ToLower(lang)] = catalog
+	}
+	return t
+}
+
+// Load creates a translator using the catalogs in the given directory. Each catalog is a YAML or JSON file
+// named after its language tag, such as "en.yml" or "pt-BR.json", which maps message keys to messages.
+func Load(dir string) (*Translator, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	catalogs := map[string]map[string]string{}
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || ext != ".yml" && ext != ".yaml" && ext != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		catalog := map[string]string{}
+		if ext == ".json" {
+			err = json.Unmarshal(data, &catalog)
+		} else {
+			err = yaml.Unmarshal(data, &catalog)
+		}
+		if err != nil {
+			return nil, err
+		}
+		catalogs[strings.TrimSuffix(file.Name(), ext)] = catalog
+	}
+	return New(catalogs), nil
+}
+
+// Lookup returns the message with the given key in the given language. If the catalog of the language does not
+// contain the message, the message in DefaultLanguage is returned. False is returned if the message is not found.
+func (t *Translator) Lookup(lang, key string) (string, bool) {
+	if msg, ok := t.catalogs[strings.ToLower(lang)][key]; ok {
+		return msg, true
+	}
+	msg, ok := t.catalogs[DefaultLanguage][key]
+	return msg, ok
+}
+
+// Translate returns the message with the given key in the given language, falling back to DefaultLanguage.
+// The message may refer to the given parameters in the text/template syntax, such as "{{.max}}".
+// False is returned if the message is not found.
+func (t *Translator) Translate(lang, key string, params map[string]interface{}) (string, bool) {
+	msg, ok := t.Lookup(lang, key)
+	if !ok || len(params) == 0 || !strings.Contains(msg, "{{") {
+		return msg, ok
+	}
+	tmpl, err := template.New("").Parse(msg)
+	if err != nil {
+		return msg, true
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return msg, true
+	}
+	return buf.String(), true
+}
+
+// Match returns the lower-cased language tag of the catalog that best matches the languages listed in
+// an Accept-Language header.
+// A language such as "de-AT" matches the catalog of "de" if there is no catalog of "de-AT".
+// DefaultLanguage is returned if no catalog matches.
+func (t *Translator) Match(acceptLanguage string) string {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if _, ok := t.catalogs[tag]; ok {
+			return tag
+		}
+		if i := strings.IndexByte(tag, '-'); i > 0 {
+			if _, ok := t.catalogs[tag[:i]]; ok {
+				return tag[:i]
+			}
+		}
+	}
+	return DefaultLanguage
+}
+
+// Handler returns a middleware that stores the language preferred by the client in the request context.
+// The language can be obtained via Language().
+func (t *Translator) Handler() routing.Handler {
+	return func(c *routing.Context) error {
+		lang := t.Match(c.Request.Header.Get("Accept-Language"))
+		c.Request = c.Request.WithContext(WithLanguage(c.Request.Context(), lang))
+		return nil
+	}
+}
+
+type contextKey int
+
+const languageKey contextKey = iota
+
+// WithLanguage returns a context that contains the given language.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey, lang)
+}
+
+// Language returns the language stored in the given context.
+// An empty string is returned if the context does not contain a language.
+func Language(ctx context.Context) string {
+	lang, _ := ctx.Value(languageKey).(string)
+	return lang
+}
+
+// parseAcceptLanguage returns the lower-cased language tags in an Accept-Language header, ordered by preference.
+func parseAcceptLanguage(header string) []string {
+	type weightedTag struct {
+		tag string
+		q   float64
+	}
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weightedTag{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
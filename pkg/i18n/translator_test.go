@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"context"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	_ = ioutil.WriteFile(filepath.Join(dir, "en.yml"), []byte("hello: Hello\nbye: Bye\n"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "pt-BR.json"), []byte(`{"hello": "Olá"}`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a catalog"), 0644)
+
+	tr, err := Load(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2, len(tr.catalogs))
+		msg, _ := tr.Lookup("pt-br", "hello")
+		assert.Equal(t, "Olá", msg)
+	}
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "de.yml"), []byte("- invalid"), 0644)
+	_, err = Load(dir)
+	assert.NotNil(t, err)
+
+	_, err = Load(filepath.Join(dir, "unknown"))
+	assert.NotNil(t, err)
+}
+
+func TestTranslator_Translate(t *testing.T) {
+	tr := New(map[string]map[string]string{
+		"en": {"hello": "Hello", "length": "the length must be no more than {{.max}}"},
+		"de": {"length": "die Länge darf höchstens {{.max}} betragen"},
+	})
+
+	msg, ok := tr.Translate("de", "length", map[string]interface{}{"max": 10})
+	assert.True(t, ok)
+	assert.Equal(t, "die Länge darf höchstens 10 betragen", msg)
+
+	msg, ok = tr.Translate("de", "hello", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "Hello", msg)
+
+	msg, ok = tr.Translate("fr", "length", map[string]interface{}{"max": 5})
+	assert.True(t, ok)
+	assert.Equal(t, "the length must be no more than 5", msg)
+
+	_, ok = tr.Translate("de", "unknown", nil)
+	assert.False(t, ok)
+}
+
+func TestTranslator_Match(t *testing.T) {
+	tr := New(map[string]map[string]string{"en": {}, "de": {}, "pt-BR": {}})
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"pt-BR, de;q=0.9", "pt-br"},
+		{"fr, de;q=0.5, en;q=0.8", "en"},
+		{"fr, *", "en"},
+		{"de;q=0, pt-br;q=0.1", "pt-br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, tr.Match(tt.header))
+		})
+	}
+}
+
+func TestTranslator_Handler(t *testing.T) {
+	tr := New(map[string]map[string]string{"en": {}, "de": {}})
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	c := routing.NewContext(httptest.NewRecorder(), req)
+	assert.Nil(t, tr.Handler()(c))
+	assert.Equal(t, "de", Language(c.Request.Context()))
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Empty(t, Language(context.Background()))
+	assert.Equal(t, "de", Language(WithLanguage(context.Background(), "de")))
+}
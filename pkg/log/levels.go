@@ -0,0 +1,170 @@
+package log
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+)
+
+// Options represents the options for creating a logger via NewWithOptions.
+type Options struct {
+	// Level is the minimum level of the log messages: "debug", "info", "warn" or "error". Defaults to "info".
+	Level string
+	// Encoding is the format of the log messages: "json" or "console". Defaults to "json".
+	Encoding string
+	// Outputs lists the files or URLs that the log messages are written to. Defaults to "stderr".
+	Outputs []string
+	// Packages maps the names of package loggers (see Logger.Named) to their minimum levels, overriding Level.
+	Packages map[string]string
+	// RedactFields lists the names of the fields whose values are redacted, in addition to DefaultRedactFields.
+	RedactFields []string
+	// RedactPatterns lists the regular expressions matching the text to be redacted, in addition to DefaultRedactPatterns.
+	RedactPatterns []string
+}
+
+// Levels holds the minimum levels of a logger and its package loggers. The levels can be changed at runtime.
+type Levels struct {
+	mu       sync.RWMutex
+	level    zapcore.Level
+	packages map[string]zapcore.Level
+}
+
+// NewWithOptions creates a new logger with the given options.
+// The logger redacts sensitive data from the log messages and fields (see Redactor).
+// It also returns the levels of the logger so that they can be changed while the application is running.
+func NewWithOptions(options Options) (Logger, *Levels, error) {
+	levels := &Levels{level: zapcore.InfoLevel, packages: map[string]zapcore.Level{}}
+	if options.Level != "" {
+		if err := levels.Set("", options.Level); err != nil {
+			return nil, nil, err
+		}
+	}
+	for name, level := range options.Packages {
+		if err := levels.Set(name, level); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	redactor, err := NewRedactor(options.RedactFields, options.RedactPatterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := zap.NewProductionConfig()
+	// the levels are enforced by levelCore
+	c.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	if options.Encoding == "console" {
+		c.Encoding = "console"
+		c.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	} else if options.Encoding != "" && options.Encoding != "json" {
+		return nil, nil, fmt.Errorf("unknown log encoding %q", options.Encoding)
+	}
+	if len(options.Outputs) > 0 {
+		c.OutputPaths = options.Outputs
+	}
+	l, err := c.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: &redactCore{Core: core, redactor: redactor}, levels: levels}
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewWithZap(l), levels, nil
+}
+
+// Set sets the minimum level of the named package logger, or that of the logger if the name is empty.
+// The level of a package logger also applies to the loggers named after its subpackages (e.g. "album.stream").
+func (l *Levels) Set(name, level string) error {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if name == "" {
+		l.level = lvl
+	} else {
+		l.packages[name] = lvl
+	}
+	return nil
+}
+
+// Reset removes the level of the named package logger so that the level of the logger applies to it again.
+func (l *Levels) Reset(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.packages, name)
+}
+
+// Level returns the minimum level of the logger.
+func (l *Levels) Level() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level.String()
+}
+
+// Packages returns the minimum levels of the package loggers that override the level of the logger.
+func (l *Levels) Packages() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	packages := map[string]string{}
+	for name, level := range l.packages {
+		packages[name] = level.String()
+	}
+	return packages
+}
+
+// enabled returns whether a message of the given level should be logged by the named logger.
+func (l *Levels) enabled(name string, level zapcore.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for name != "" {
+		if lvl, ok := l.packages[name]; ok {
+			return lvl.Enabled(level)
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return l.level.Enabled(level)
+}
+
+// min returns the lowest of the minimum levels.
+func (l *Levels) min() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	min := l.level
+	for _, lvl := range l.packages {
+		if lvl < min {
+			min = lvl
+		}
+	}
+	return min
+}
+
+// levelCore is a zapcore.Core that filters the log messages by the levels of their loggers.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+// Enabled is required by the zapcore.Core interface. It reports whether any logger may log at the given level.
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return level >= c.levels.min()
+}
+
+// With is required by the zapcore.Core interface.
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+// Check is required by the zapcore.Core interface.
+func (c *levelCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.enabled(entry.LoggerName, entry.Level) {
+		return ce
+	}
+	return c.Core.Check(entry, ce)
+}
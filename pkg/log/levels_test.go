@@ -0,0 +1,89 @@
+package log
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+
+	logger, levels, err := NewWithOptions(Options{
+		Level:    "warn",
+		Encoding: "console",
+		Outputs:  []string{file},
+		Packages: map[string]string{"album": "debug"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "warn", levels.Level())
+	assert.Equal(t, map[string]string{"album": "debug"}, levels.Packages())
+
+	logger.Info("skipped")
+	logger.Warn("logged warning")
+	logger.Named("album").Debug("logged debug")
+	logger.Warnf("sent to %v", "john@example.com")
+	bytes, _ := ioutil.ReadFile(file)
+	assert.NotContains(t, string(bytes), "skipped")
+	assert.Contains(t, string(bytes), "logged warning")
+	assert.Contains(t, string(bytes), "logged debug")
+	assert.Contains(t, string(bytes), "sent to [REDACTED]")
+
+	_, _, err = NewWithOptions(Options{Level: "verbose"})
+	assert.NotNil(t, err)
+	_, _, err = NewWithOptions(Options{Packages: map[string]string{"album": "verbose"}})
+	assert.NotNil(t, err)
+	_, _, err = NewWithOptions(Options{Encoding: "xml"})
+	assert.NotNil(t, err)
+	_, _, err = NewWithOptions(Options{RedactPatterns: []string{"("}})
+	assert.NotNil(t, err)
+}
+
+func TestLevels(t *testing.T) {
+	levels := &Levels{level: zapcore.InfoLevel, packages: map[string]zapcore.Level{}}
+	core, entries := observer.New(zapcore.DebugLevel)
+	logger := NewWithZap(zap.New(&levelCore{Core: core, levels: levels}))
+
+	logger.Debug("a")
+	logger.Named("album").Debug("b")
+	assert.Equal(t, 0, entries.Len())
+
+	assert.Nil(t, levels.Set("album", "debug"))
+	logger.Debug("c")
+	logger.Named("album").Debug("d")
+	logger.Named("album").Named("stream").Debugf("%v", "e")
+	logger.Named("auth").Debug("f")
+	if assert.Equal(t, 2, entries.Len()) {
+		assert.Equal(t, "d", entries.All()[0].Message)
+		assert.Equal(t, "album", entries.All()[0].LoggerName)
+		assert.Equal(t, "e", entries.All()[1].Message)
+	}
+	entries.TakeAll()
+
+	assert.Nil(t, levels.Set("", "error"))
+	logger.Warnf("%v", "g")
+	logger.Named("auth").Error("h")
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, "h", entries.All()[0].Message)
+	}
+	entries.TakeAll()
+
+	levels.Reset("album")
+	logger.Named("album").Info("i")
+	assert.Equal(t, 0, entries.Len())
+	assert.Equal(t, map[string]string{}, levels.Packages())
+
+	assert.NotNil(t, levels.Set("album", "verbose"))
+}
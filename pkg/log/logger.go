@@ -4,6 +4,7 @@ package log
 import (
 	"context"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
@@ -14,11 +15,15 @@ import (
 type Logger interface {
 	// With returns a logger based off the root logger and decorates it with the given context and arguments.
 	With(ctx context.Context, args ...interface{}) Logger
+	// Named returns a logger for the named package. Its level can be set separately (see Levels).
+	Named(name string) Logger
 
 	// Debug uses fmt.Sprint to construct and log a message at DEBUG level
 	Debug(args ...interface{})
 	// Info uses fmt.Sprint to construct and log a message at INFO level
 	Info(args ...interface{})
+	// Warn uses fmt.Sprint to construct and log a message at WARN level
+	Warn(args ...interface{})
 	// Error uses fmt.Sprint to construct and log a message at ERROR level
 	Error(args ...interface{})
 
@@ -26,6 +31,8 @@ type Logger interface {
 	Debugf(format string, args ...interface{})
 	// Infof uses fmt.Sprintf to construct and log a message at INFO level
 	Infof(format string, args ...interface{})
+	// Warnf uses fmt.Sprintf to construct and log a message at WARN level
+	Warnf(format string, args ...interface{})
 	// Errorf uses fmt.Sprintf to construct and log a message at ERROR level
 	Errorf(format string, args ...interface{})
 }
@@ -62,6 +69,7 @@ func NewForTest() (Logger, *observer.ObservedLogs) {
 //
 // If the context contains request ID and/or correlation ID information (recorded via WithRequestID()
 // and WithCorrelationID()), they will be added to every log message generated by the new logger.
+// So will the trace ID and span ID of the OpenTelemetry span in the context, if any.
 //
 // The arguments should be specified as a sequence of name, value pairs with names being strings.
 // The arguments will also be added to every log message generated by the logger.
@@ -73,6 +81,9 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 		if id, ok := ctx.Value(correlationIDKey).(string); ok {
 			args = append(args, zap.String("correlation_id", id))
 		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			args = append(args, zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+		}
 	}
 	if len(args) > 0 {
 		return &logger{l.SugaredLogger.With(args...)}
@@ -80,6 +91,13 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 	return l
 }
 
+// Named returns a logger for the named package, such as "album".
+// The name is added to every log message, and the level of the logger can be set separately via Levels.
+// Nested names are joined with periods, so that the level of "album" also applies to "album.stream".
+func (l *logger) Named(name string) Logger {
+	return &logger{l.SugaredLogger.Named(name)}
+}
+
 // WithRequest returns a context which knows the request ID and correlation ID in the given request.
 func WithRequest(ctx context.Context, req *http.Request) context.Context {
 	id := getRequestID(req)
@@ -93,6 +111,13 @@ func WithRequest(ctx context.Context, req *http.Request) context.Context {
 	return ctx
 }
 
+// RequestID returns the request ID recorded in the given context via WithRequest().
+// An empty string is returned if the context does not contain a request ID.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
 // getCorrelationID extracts the correlation ID from the HTTP request
 func getCorrelationID(req *http.Request) string {
 	return req.Header.Get("X-Correlation-ID")
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/http"
 	"reflect"
@@ -32,6 +33,12 @@ func TestWithRequest(t *testing.T) {
 	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
 }
 
+func TestRequestID(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+	ctx := WithRequest(context.Background(), buildRequest("abc", ""))
+	assert.Equal(t, "abc", RequestID(ctx))
+}
+
 func Test_getCorrelationID(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", bytes.NewBufferString(""))
 	assert.Empty(t, getCorrelationID(req))
@@ -57,6 +64,22 @@ func Test_logger_With(t *testing.T) {
 	assert.False(t, reflect.DeepEqual(l3, l2))
 }
 
+func Test_logger_With_trace(t *testing.T) {
+	logger, entries := NewForTest()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	logger.With(ctx).Info("msg")
+	if assert.Equal(t, 1, entries.Len()) {
+		fields := entries.All()[0].ContextMap()
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+		assert.Equal(t, "00f067aa0ba902b7", fields["span_id"])
+	}
+}
+
 func buildRequest(requestID, correlationID string) *http.Request {
 	req, _ := http.NewRequest("GET", "http://example.com", bytes.NewBufferString(""))
 	if requestID != "" {
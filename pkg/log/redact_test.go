@@ -0,0 +1,73 @@
+package log
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	r, err := NewRedactor(nil, []string{`card=(\d+)`})
+	if !assert.Nil(t, err) {
+		return
+	}
+	tests := []struct {
+		name, text, want string
+	}{
+		{"no sensitive data", "GET /v1/albums 200", "GET /v1/albums 200"},
+		{"email", "user john.doe@example.com logged in", "user [REDACTED] logged in"},
+		{"jwt", "token eyJhbGciOiJIUzI1NiJ9.eyJpZCI6IjEwMCJ9.abc-_", "token [REDACTED]"},
+		{"bearer", "Authorization: Bearer abc.def", "Authorization: Bearer [REDACTED]"},
+		{"password", `{"username":"demo","password":"pass"}`, `{"username":"demo","password":"[REDACTED]"}`},
+		{"dsn", "postgres://127.0.0.1/db?sslmode=disable&user=postgres&password=secret", "postgres://127.0.0.1/db?sslmode=disable&user=postgres&password=[REDACTED]"},
+		{"url credentials", "dial postgres://admin:s3cret@db:5432/app failed", "dial postgres://admin:[REDACTED]@db:5432/app failed"},
+		{"custom pattern", "card=4111 card=4222", "card=[REDACTED] card=[REDACTED]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Redact(tt.text))
+		})
+	}
+
+	_, err = NewRedactor(nil, []string{"("})
+	assert.NotNil(t, err)
+}
+
+func TestRedactor_RedactJSON(t *testing.T) {
+	r, _ := NewRedactor([]string{"ssn"}, nil)
+	assert.Equal(t, `{"items":[{"ssn":"[REDACTED]"}],"name":"demo","note":"mail [REDACTED]","price":12.50,"username":"[REDACTED]"}`,
+		r.RedactJSON(`{"username":"demo","name":"demo","price":12.50,"note":"mail demo@example.com","items":[{"ssn":"123"}]}`))
+	// invalid JSON is redacted as text
+	assert.Equal(t, `{"password":"[REDACTED]`, r.RedactJSON(`{"password":"pass`))
+}
+
+func Test_redactCore(t *testing.T) {
+	r, _ := NewRedactor([]string{"ssn"}, nil)
+	core, entries := observer.New(zapcore.InfoLevel)
+	logger := NewWithZap(zap.New(&redactCore{Core: core, redactor: r}))
+
+	logger.With(nil, "user", "demo", "SSN", 123).Infof("sent to %v", "john@example.com")
+	logger.With(nil, "sql", "password=abc", "error", errors.New("login of john@example.com failed")).Info("ok")
+	logger.Debug("skipped")
+
+	if assert.Equal(t, 2, entries.Len()) {
+		e := entries.All()[0]
+		assert.Equal(t, "sent to [REDACTED]", e.Message)
+		assert.Equal(t, "[REDACTED]", e.ContextMap()["user"])
+		assert.Equal(t, "[REDACTED]", e.ContextMap()["SSN"])
+
+		e = entries.All()[1]
+		assert.Equal(t, "password=[REDACTED]", e.ContextMap()["sql"])
+		assert.Equal(t, "login of [REDACTED] failed", e.ContextMap()["error"])
+	}
+}
+
+func TestMaskSQL(t *testing.T) {
+	assert.Equal(t,
+		"SELECT * FROM album WHERE name=? AND id=? AND t1.x=? LIMIT ? OFFSET ?",
+		MaskSQL("SELECT * FROM album WHERE name='O''Brien' AND id='abc-123' AND t1.x=1.5 LIMIT 100 OFFSET 0"),
+	)
+}
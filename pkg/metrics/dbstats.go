@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector reports the connection pool statistics returned by sql.DB.Stats().
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector(db *sql.DB) *dbStatsCollector {
+	return &dbStatsCollector{
+		db:                db,
+		maxOpen:           prometheus.NewDesc("db_max_open_connections", "Maximum number of open connections to the database.", nil, nil),
+		open:              prometheus.NewDesc("db_open_connections", "Number of established connections both in use and idle.", nil, nil),
+		inUse:             prometheus.NewDesc("db_in_use_connections", "Number of connections currently in use.", nil, nil),
+		idle:              prometheus.NewDesc("db_idle_connections", "Number of idle connections.", nil, nil),
+		waitCount:         prometheus.NewDesc("db_wait_count_total", "Total number of connections waited for.", nil, nil),
+		waitDuration:      prometheus.NewDesc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", nil, nil),
+		maxIdleClosed:     prometheus.NewDesc("db_max_idle_closed_total", "Total number of connections closed due to the maximum number of idle connections.", nil, nil),
+		maxLifetimeClosed: prometheus.NewDesc("db_max_lifetime_closed_total", "Total number of connections closed due to the maximum connection lifetime.", nil, nil),
+	}
+}
+
+// Describe is required by the prometheus.Collector interface.
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect is required by the prometheus.Collector interface.
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
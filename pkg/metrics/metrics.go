@@ -0,0 +1,107 @@
+// Package metrics collects the HTTP, database and runtime metrics of the application and exposes them
+// in the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics collects the metrics of the application. It is an http.Handler serving the collected metrics.
+type Metrics struct {
+	registry        *prometheus.Registry
+	handler         http.Handler
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dbDuration      *prometheus.HistogramVec
+	cacheRequests   *prometheus.CounterVec
+}
+
+// New creates a new Metrics which also collects the Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests processed, partitioned by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time spent on processing HTTP requests, partitioned by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_operation_duration_seconds",
+			Help:    "Time spent on DB queries and executions, partitioned by operation and result.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "result"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_requests_total",
+			Help: "Number of cache lookups, partitioned by cache and result (hit or miss).",
+		}, []string{"cache", "result"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.dbDuration,
+		m.cacheRequests,
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// ServeHTTP serves the collected metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
+
+// ObserveDBQuery records the duration of a DB query.
+func (m *Metrics) ObserveDBQuery(d time.Duration, err error) {
+	m.observeDB("query", d, err)
+}
+
+// ObserveDBExec records the duration of a DB execution.
+func (m *Metrics) ObserveDBExec(d time.Duration, err error) {
+	m.observeDB("exec", d, err)
+}
+
+// observeDB records the duration of a DB operation.
+func (m *Metrics) observeDB(operation string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.dbDuration.WithLabelValues(operation, result).Observe(d.Seconds())
+}
+
+// ObserveCache records a lookup of the given cache and whether it was a hit.
+func (m *Metrics) ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// RegisterDB registers a collector reporting the connection pool statistics of the given database.
+func (m *Metrics) RegisterDB(db *sql.DB) error {
+	return m.registry.Register(newDBStatsCollector(db))
+}
+
+// RegisterBuildInfo registers the app_build_info metric, whose labels describe the build of the running binary
+// and whose value is always 1.
+func (m *Metrics) RegisterBuildInfo(info buildinfo.Info) error {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "app_build_info",
+		Help: "Build information of the running binary, with the value 1.",
+	}, []string{"version", "commit", "build_time", "dirty", "go_version"})
+	g.WithLabelValues(info.Version, info.Commit, info.BuildTime, strconv.FormatBool(info.Dirty), info.GoVersion).Set(1)
+	return m.registry.Register(g)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/qiangxue/go-rest-api/pkg/buildinfo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics served by m.
+func scrape(t *testing.T, m *Metrics) string {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	m.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	body, _ := ioutil.ReadAll(res.Body)
+	return string(body)
+}
+
+func TestNew(t *testing.T) {
+	m := New()
+	body := scrape(t, m)
+	assert.Contains(t, body, "go_goroutines")
+	assert.Contains(t, body, "process_cpu_seconds_total")
+}
+
+func TestMetrics_ObserveDB(t *testing.T) {
+	m := New()
+	m.ObserveDBQuery(2*time.Millisecond, nil)
+	m.ObserveDBQuery(time.Millisecond, errors.New("failed"))
+	m.ObserveDBExec(time.Millisecond, nil)
+	body := scrape(t, m)
+	assert.Contains(t, body, `db_operation_duration_seconds_count{operation="query",result="success"} 1`)
+	assert.Contains(t, body, `db_operation_duration_seconds_count{operation="query",result="error"} 1`)
+	assert.Contains(t, body, `db_operation_duration_seconds_count{operation="exec",result="success"} 1`)
+}
+
+func TestMetrics_ObserveCache(t *testing.T) {
+	m := New()
+	m.ObserveCache("album", true)
+	m.ObserveCache("album", true)
+	m.ObserveCache("album", false)
+	body := scrape(t, m)
+	assert.Contains(t, body, `cache_requests_total{cache="album",result="hit"} 2`)
+	assert.Contains(t, body, `cache_requests_total{cache="album",result="miss"} 1`)
+}
+
+func TestMetrics_RegisterDB(t *testing.T) {
+	m := New()
+	db := sql.OpenDB(connector{})
+	db.SetMaxOpenConns(5)
+	assert.Nil(t, m.RegisterDB(db))
+	body := scrape(t, m)
+	assert.Contains(t, body, "db_max_open_connections 5")
+	assert.Contains(t, body, "db_open_connections 0")
+	assert.Contains(t, body, "db_wait_count_total 0")
+}
+
+func TestMetrics_RegisterBuildInfo(t *testing.T) {
+	m := New()
+	assert.Nil(t, m.RegisterBuildInfo(buildinfo.Info{Version: "1.0.0", Commit: "abc", GoVersion: "go1.18"}))
+	body := scrape(t, m)
+	assert.Contains(t, body, `app_build_info{build_time="",commit="abc",dirty="false",go_version="go1.18",version="1.0.0"} 1`)
+	// the build info can only be registered once
+	assert.NotNil(t, m.RegisterBuildInfo(buildinfo.Info{Version: "1.0.0"}))
+}
+
+// connector is a driver.Connector that never connects.
+type connector struct{}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// unmatchedRoute is the route label of the requests that do not match any route.
+const unmatchedRoute = "unmatched"
+
+// Handler returns a middleware that records the number and the duration of HTTP requests.
+//
+// The requests are labeled by their route templates (e.g. "/v1/albums/<id>") rather than their paths so that
+// the number of time series stays bounded. The templates are taken from the routes of the router when the first
+// request is served, so all routes should be registered before the server starts.
+//
+// The middleware should be installed after accesslog.Handler so that the response status is captured by the same
+// response writer, which is also found through the response writers wrapping it (e.g. that of bodylog.Handler),
+// and before the error handler so that the status of error responses is final. If an error is not handled by
+// the time it reaches the middleware, the status is derived from the error as ozzo-routing does.
+func (m *Metrics) Handler() routing.Handler {
+	var (
+		once    sync.Once
+		matcher *routematch.Matcher
+	)
+	return func(c *routing.Context) error {
+		start := time.Now()
+		once.Do(func() {
+			matcher = routematch.NewForRouter(c.Router())
+		})
+
+		rw, ok := accesslog.LogResponseWriter(c.Response)
+		if !ok {
+			rw = &access.LogResponseWriter{ResponseWriter: c.Response, Status: http.StatusOK}
+			c.Response = rw
+		}
+
+		err := c.Next()
+
+		route := unmatchedRoute
+		if pattern, ok := matcher.Match(c.Request.Method, c.Request.URL.Path); ok {
+			route = routematch.Path(pattern)
+		}
+		status := rw.Status
+		if err != nil {
+			// the error has not been turned into a response yet; the router will respond the same way
+			status = http.StatusInternalServerError
+			if httpError, ok := err.(routing.HTTPError); ok {
+				status = httpError.StatusCode()
+			}
+		}
+		labels := []string{c.Request.Method, route, strconv.Itoa(status)}
+		m.requests.WithLabelValues(labels...).Inc()
+		m.requestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
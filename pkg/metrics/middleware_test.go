@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/bodylog"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	router := routing.New()
+	router.Use(m.Handler())
+	router.Get("/v1/albums/<id>", func(c *routing.Context) error {
+		return c.Write("ok")
+	})
+	router.To("GET,HEAD", "/healthcheck", func(c *routing.Context) error {
+		return c.Write("OK")
+	})
+
+	for _, path := range []string{"/v1/albums/1", "/v1/albums/2", "/healthcheck", "/unknown"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/v1/albums/<id>",status="200"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/healthcheck",status="200"} 1`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/v1/albums/<id>",status="200"} 2`)
+}
+
+func TestMetrics_Handler_accessLog(t *testing.T) {
+	m := New()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/albums", nil)
+	rw := &access.LogResponseWriter{ResponseWriter: res, Status: http.StatusOK}
+	c := routing.NewContext(rw, req, m.Handler(), func(c *routing.Context) error {
+		// the response writer installed by the access log middleware is reused
+		assert.Equal(t, rw, c.Response)
+		c.Response.WriteHeader(http.StatusCreated)
+		return nil
+	})
+	assert.Nil(t, c.Next())
+	assert.Contains(t, scrape(t, m), `http_requests_total{method="POST",route="unmatched",status="201"} 1`)
+}
+
+func TestMetrics_Handler_bodyLog(t *testing.T) {
+	logger, _ := log.NewForTest()
+	m := New()
+	router := routing.New()
+	// the middlewares are installed in the same order as by the server
+	router.Use(accesslog.Handler(logger, accesslog.Options{}), bodylog.Handler(bodylog.Options{Routes: []string{"POST /albums"}}), m.Handler())
+	router.Post("/albums", func(c *routing.Context) error {
+		// the response writer installed by the access log middleware is found behind that of the body log
+		_, ok := c.Response.(*access.LogResponseWriter)
+		assert.False(t, ok)
+		c.Response.WriteHeader(http.StatusCreated)
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/albums", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Contains(t, scrape(t, m), `http_requests_total{method="POST",route="/albums",status="201"} 1`)
+}
@@ -0,0 +1,34 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// invalidNameRegexp matches the characters not allowed in the names of migration files.
+var invalidNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Create creates the empty up and down SQL files of a new migration with the given name in the given directory,
+// and returns their paths. The version of the migration is derived from the given time.
+func Create(dir, name string, now time.Time) ([]string, error) {
+	name = strings.Trim(invalidNameRegexp.ReplaceAllString(strings.TrimSpace(name), "_"), "_")
+	if name == "" {
+		return nil, fmt.Errorf("the migration name is required")
+	}
+	prefix := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+strings.ToLower(name))
+	files := []string{prefix + ".up.sql", prefix + ".down.sql"}
+	for _, file := range files {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
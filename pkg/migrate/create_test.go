@@ -0,0 +1,36 @@
+package migrate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 12, 30, 45, 0, time.UTC)
+
+	files, err := Create(dir, " Add album genre! ", now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "20261019123045_add_album_genre.up.sql"),
+		filepath.Join(dir, "20261019123045_add_album_genre.down.sql"),
+	}, files)
+	for _, file := range files {
+		_, err := os.Stat(file)
+		assert.Nil(t, err)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{{Version: 20261019123045, Name: "add_album_genre"}}, migrations)
+
+	// existing files are not overwritten
+	_, err = Create(dir, "add_album_genre", now)
+	assert.NotNil(t, err)
+
+	_, err = Create(dir, " !! ", now)
+	assert.NotNil(t, err)
+}
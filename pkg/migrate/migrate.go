@@ -0,0 +1,322 @@
+// Package migrate runs the database migrations written as pairs of SQL files, such as "20191217202658_init.up.sql"
+// and "20191217202658_init.down.sql".
+//
+// The version of the latest migration applied is recorded in the schema_migrations table, in the same way as
+// golang-migrate, so that databases migrated by either tool can be migrated by the other. Each migration runs in
+// a transaction together with the update of the version, so that a failed migration leaves the database unchanged.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey is the key of the PostgreSQL advisory lock which prevents multiple processes from migrating
+// the same database at the same time.
+const lockKey = 8317452036547101843
+
+// fileRegexp matches the names of migration files and captures their versions, names and directions.
+var fileRegexp = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+
+// Migration represents a database migration.
+type Migration struct {
+	// Version is the version of the migration, which is usually the time the migration was created.
+	Version int64
+	// Name is the name of the migration.
+	Name string
+	// Up is the SQL applying the migration.
+	Up string
+	// Down is the SQL reverting the migration.
+	Down string
+}
+
+// Migrator migrates a PostgreSQL or SQLite database.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+	logFunc    func(format string, args ...interface{})
+}
+
+// New creates a Migrator which migrates the given database using the migration files in the root of fsys.
+// The driver is the name of the database driver: "postgres" or "sqlite3". The given function, if not nil,
+// is called to report each migration applied or reverted.
+func New(db *sql.DB, driver string, fsys fs.FS, logFunc func(format string, args ...interface{})) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if logFunc == nil {
+		logFunc = func(string, ...interface{}) {}
+	}
+	return &Migrator{db, driver, migrations, logFunc}, nil
+}
+
+// Load reads the migration files in the root of fsys and returns the migrations sorted by their versions.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %v", entry.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("duplicate migration version %v: %q and %q", version, m.Name, matches[2])
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if matches[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	var migrations []Migration
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the migrations sorted by their versions.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Version returns the version of the latest migration applied, or zero if none is, and whether the database was left
+// dirty by a migration that failed halfway, such as one run by golang-migrate, and must be fixed manually.
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err = readVersion(ctx, conn)
+		return err
+	})
+	return
+}
+
+// Up applies all migrations that have not been applied.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the given number of the latest migrations applied.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.migrate(ctx, func(current int64) (int64, error) {
+		if current == 0 {
+			return 0, nil
+		}
+		i := m.index(current)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown current version %v", current)
+		}
+		if i-steps < 0 {
+			return 0, nil
+		}
+		return m.migrations[i-steps].Version, nil
+	})
+}
+
+// Goto applies or reverts the migrations so that the given version becomes the latest migration applied.
+// The version zero reverts all migrations.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("unknown migration version %v", version)
+	}
+	return m.migrate(ctx, func(int64) (int64, error) {
+		return version, nil
+	})
+}
+
+// Force records the given version as the latest migration applied without running any migration, and clears
+// the dirty flag. It is used after fixing a database whose migration failed halfway.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := writeVersion(ctx, tx, version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// migrate applies or reverts the migrations from the current version to the target version.
+func (m *Migrator) migrate(ctx context.Context, target func(current int64) (int64, error)) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("the migration %v failed halfway: fix the database and force its version", current)
+		}
+		to, err := target(current)
+		if err != nil {
+			return err
+		}
+		steps, err := m.plan(current, to)
+		if err != nil {
+			return err
+		}
+		for _, s := range steps {
+			if err := m.run(ctx, conn, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// step represents running the SQL of a migration to bring the database to a version.
+type step struct {
+	migration Migration
+	up        bool
+	version   int64
+}
+
+// plan returns the steps that bring the database from the current version to the target version.
+func (m *Migrator) plan(current, target int64) ([]step, error) {
+	if current != 0 && m.index(current) < 0 {
+		return nil, fmt.Errorf("unknown current version %v", current)
+	}
+	var steps []step
+	if target >= current {
+		for _, migration := range m.migrations {
+			if migration.Version > current && migration.Version <= target {
+				steps = append(steps, step{migration, true, migration.Version})
+			}
+		}
+		return steps, nil
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= target || migration.Version > current {
+			continue
+		}
+		var version int64
+		if i > 0 {
+			version = m.migrations[i-1].Version
+		}
+		steps = append(steps, step{migration, false, version})
+	}
+	return steps, nil
+}
+
+// run runs a step of migration and records the resulting version in the same transaction.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, s step) error {
+	query, direction := s.migration.Up, "applying"
+	if !s.up {
+		query, direction = s.migration.Down, "reverting"
+	}
+	m.logFunc("%s migration %v_%s", direction, s.migration.Version, s.migration.Name)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("%s migration %v_%s: %v", direction, s.migration.Version, s.migration.Name, err)
+	}
+	if err := writeVersion(ctx, tx, s.version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// index returns the index of the migration with the given version, or -1 if there is no such migration.
+func (m *Migrator) index(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// withLock calls the given function with a connection holding the migration lock, so that only one process
+// migrates the database at a time. The schema_migrations table is created if it does not exist.
+// SQLite databases are not locked since they only support a single server instance.
+//
+// The statement and lock timeouts of the PostgreSQL session are disabled while the connection is used, because
+// waiting for the migrations of another process and running a long migration must not time out.
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.driver == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, "SET lock_timeout = 0"); err != nil {
+			return err
+		}
+		defer func() {
+			// restore the timeouts of the session before the connection returns to the pool
+			if _, e := conn.ExecContext(context.Background(), "RESET statement_timeout; RESET lock_timeout"); e != nil && err == nil {
+				err = e
+			}
+		}()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			return err
+		}
+		defer func() {
+			if _, e := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+// readVersion reads the version recorded in the schema_migrations table.
+func readVersion(ctx context.Context, conn *sql.Conn) (version int64, dirty bool, err error) {
+	err = conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return
+}
+
+// writeVersion records the given version in the schema_migrations table. The version zero clears the table.
+func writeVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, FALSE)", version)
+	return err
+}
@@ -0,0 +1,228 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"3_add_index.up.sql":     {Data: []byte("CREATE INDEX")},
+	"3_add_index.down.sql":   {Data: []byte("DROP INDEX")},
+	"1_init.up.sql":          {Data: []byte("CREATE TABLE")},
+	"1_init.down.sql":        {Data: []byte("DROP TABLE")},
+	"2_add_column.up.sql":    {Data: []byte("ALTER TABLE ADD")},
+	"2_add_column.down.sql":  {Data: []byte("ALTER TABLE DROP")},
+	"migrations.go":          {Data: []byte("package migrations")},
+	"README.md":              {Data: []byte("migrations")},
+	"4_invalid.sideways.sql": {Data: []byte("")},
+	"sub/5_nested.up.sql":    {Data: []byte("")},
+	"sub/5_nested.down.sql":  {Data: []byte("")},
+	"sub/README.md":          {Data: []byte("")},
+	"not_a_version.up.sql":   {Data: []byte("")},
+	"not_a_version.down.sql": {Data: []byte("")},
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFS)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{
+		{1, "init", "CREATE TABLE", "DROP TABLE"},
+		{2, "add_column", "ALTER TABLE ADD", "ALTER TABLE DROP"},
+		{3, "add_index", "CREATE INDEX", "DROP INDEX"},
+	}, migrations)
+
+	_, err = Load(fstest.MapFS{
+		"1_init.up.sql":  {Data: []byte("")},
+		"1_other.up.sql": {Data: []byte("")},
+	})
+	assert.NotNil(t, err)
+
+	_, err = Load(fstest.MapFS{"99999999999999999999_overflow.up.sql": {Data: []byte("")}})
+	assert.NotNil(t, err)
+}
+
+func TestMigrator_plan(t *testing.T) {
+	m, err := New(nil, "postgres", testFS, nil)
+	assert.Nil(t, err)
+	assert.Len(t, m.Migrations(), 3)
+
+	versions := func(steps []step) (up []bool, to []int64) {
+		for _, s := range steps {
+			up = append(up, s.up)
+			to = append(to, s.version)
+		}
+		return
+	}
+
+	steps, err := m.plan(0, 3)
+	assert.Nil(t, err)
+	up, to := versions(steps)
+	assert.Equal(t, []bool{true, true, true}, up)
+	assert.Equal(t, []int64{1, 2, 3}, to)
+
+	steps, err = m.plan(1, 2)
+	assert.Nil(t, err)
+	up, to = versions(steps)
+	assert.Equal(t, []bool{true}, up)
+	assert.Equal(t, []int64{2}, to)
+
+	steps, err = m.plan(3, 1)
+	assert.Nil(t, err)
+	up, to = versions(steps)
+	assert.Equal(t, []bool{false, false}, up)
+	assert.Equal(t, []int64{2, 1}, to)
+	assert.Equal(t, "DROP INDEX", steps[0].migration.Down)
+
+	steps, err = m.plan(2, 0)
+	assert.Nil(t, err)
+	_, to = versions(steps)
+	assert.Equal(t, []int64{1, 0}, to)
+
+	steps, err = m.plan(3, 3)
+	assert.Nil(t, err)
+	assert.Empty(t, steps)
+
+	_, err = m.plan(5, 3)
+	assert.NotNil(t, err)
+}
+
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+	// keep the in-memory database in a single connection
+	db.SetMaxOpenConns(1)
+	fsys := fstest.MapFS{
+		"1_init.up.sql":       {Data: []byte("CREATE TABLE album (id VARCHAR PRIMARY KEY)")},
+		"1_init.down.sql":     {Data: []byte("DROP TABLE album")},
+		"2_add_name.up.sql":   {Data: []byte("ALTER TABLE album ADD COLUMN name VARCHAR")},
+		"2_add_name.down.sql": {Data: []byte("ALTER TABLE album DROP COLUMN name")},
+		"3_add_year.up.sql":   {Data: []byte("ALTER TABLE album ADD COLUMN year INTEGER")},
+		"3_add_year.down.sql": {Data: []byte("ALTER TABLE album DROP COLUMN year")},
+		"4_broken.up.sql":     {Data: []byte("ALTER TABLE album ADD COLUMN year INTEGER")},
+		"4_broken.down.sql":   {Data: []byte("")},
+	}
+	var logged []interface{}
+	m, err := New(db, "sqlite3", fsys, func(format string, args ...interface{}) {
+		logged = append(logged, args[1])
+	})
+	assert.Nil(t, err)
+	ctx := context.Background()
+	version := func() int64 {
+		v, dirty, err := m.Version(ctx)
+		assert.Nil(t, err)
+		assert.False(t, dirty)
+		return v
+	}
+	assert.Equal(t, int64(0), version())
+
+	assert.Nil(t, m.Goto(ctx, 3))
+	assert.Equal(t, int64(3), version())
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, logged)
+	_, err = db.Exec("INSERT INTO album (id, name, year) VALUES ('1', 'KIRK', 2019)")
+	assert.Nil(t, err)
+
+	// a failed migration leaves the database at the previous version
+	assert.NotNil(t, m.Up(ctx))
+	assert.Equal(t, int64(3), version())
+
+	assert.Nil(t, m.Down(ctx, 2))
+	assert.Equal(t, int64(1), version())
+	assert.Nil(t, m.Down(ctx, 5))
+	assert.Equal(t, int64(0), version())
+	assert.Nil(t, m.Down(ctx, 1))
+	assert.NotNil(t, m.Goto(ctx, 9))
+
+	// a dirty database is not migrated until its version is forced
+	_, err = db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (2, TRUE)")
+	assert.Nil(t, err)
+	_, dirty, err := m.Version(ctx)
+	assert.Nil(t, err)
+	assert.True(t, dirty)
+	assert.NotNil(t, m.Up(ctx))
+	assert.Nil(t, m.Force(ctx, 1))
+	assert.Equal(t, int64(1), version())
+}
+
+// recorder is a driver.Connector whose connections record the statements they execute and find no rows.
+type recorder struct {
+	statements []string
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) {
+	return recorderConn{r}, nil
+}
+
+func (r *recorder) Driver() driver.Driver {
+	return nil
+}
+
+// recorderConn is a connection of recorder.
+type recorderConn struct {
+	r *recorder
+}
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c recorderConn) Close() error {
+	return nil
+}
+
+func (c recorderConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.r.statements = append(c.r.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c recorderConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return recorderRows{}, nil
+}
+
+// recorderRows is an empty result of recorderConn.
+type recorderRows struct{}
+
+func (recorderRows) Columns() []string {
+	return []string{"version", "dirty"}
+}
+
+func (recorderRows) Close() error {
+	return nil
+}
+
+func (recorderRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+func TestMigrator_withLock(t *testing.T) {
+	// the session timeouts are disabled while waiting for the lock and migrating, and restored afterwards
+	r := &recorder{}
+	m, err := New(sql.OpenDB(r), "postgres", testFS, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	version, _, err := m.Version(context.Background())
+	assert.Nil(t, err)
+	assert.Zero(t, version)
+	assert.Equal(t, []string{
+		"SET statement_timeout = 0",
+		"SET lock_timeout = 0",
+		"SELECT pg_advisory_lock($1)",
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+		"SELECT pg_advisory_unlock($1)",
+		"RESET statement_timeout; RESET lock_timeout",
+	}, r.statements)
+}
@@ -0,0 +1,66 @@
+// Package pgnotify delivers the notifications sent via PostgreSQL NOTIFY so that
+// multiple server instances sharing the same database can react to each other's changes.
+package pgnotify
+
+import (
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// Listener listens to a PostgreSQL notification channel.
+type Listener struct {
+	listener *pq.Listener
+	c        chan string
+}
+
+// Listen opens a dedicated database connection using the given DSN and starts listening to the named channel.
+// Listen blocks until the connection is established. The connection is re-established automatically if it is lost.
+func Listen(dsn, channel string, logger log.Logger) (*Listener, error) {
+	pl := pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Errorf("listener of channel %q: %v", channel, err)
+		}
+	})
+	if err := pl.Listen(channel); err != nil {
+		_ = pl.Close()
+		return nil, err
+	}
+	l := &Listener{pl, make(chan string, cap(pl.Notify))}
+	go l.forward()
+	return l, nil
+}
+
+// C returns the channel delivering the payloads of the received notifications.
+// An empty payload is delivered after the database connection is re-established, which indicates
+// that some notifications may have been missed. The channel is closed when the listener is closed.
+func (l *Listener) C() <-chan string {
+	return l.c
+}
+
+// Ping checks if the connection to the database is alive.
+func (l *Listener) Ping() error {
+	return l.listener.Ping()
+}
+
+// Close stops listening and closes the database connection.
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+// forward passes the notifications received by the pq listener to the payload channel.
+func (l *Listener) forward() {
+	for n := range l.listener.Notify {
+		payload := ""
+		if n != nil {
+			payload = n.Extra
+		}
+		l.c <- payload
+	}
+	close(l.c)
+}
@@ -0,0 +1,48 @@
+package pgnotify
+
+import (
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+const DSN = "postgres://127.0.0.1/go_restful?sslmode=disable&user=postgres&password=postgres"
+
+func TestListen(t *testing.T) {
+	dsn, ok := os.LookupEnv("APP_DSN")
+	if !ok {
+		dsn = DSN
+	}
+	db, err := dbx.MustOpen("postgres", dsn)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	logger, _ := log.NewForTest()
+	l, err := Listen(dsn, "pgnotifytest", logger)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	assert.Nil(t, l.Ping())
+	_, err = db.NewQuery("SELECT pg_notify('pgnotifytest', 'hello')").Execute()
+	assert.Nil(t, err)
+
+	select {
+	case payload := <-l.C():
+		assert.Equal(t, "hello", payload)
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the notification")
+	}
+
+	assert.Nil(t, l.Close())
+	_, ok = <-l.C()
+	assert.False(t, ok)
+}
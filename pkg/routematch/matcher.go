@@ -0,0 +1,127 @@
+// Package routematch matches HTTP requests against route patterns written in the ozzo-routing syntax,
+// so that middlewares installed at the router level can apply route-specific settings.
+package routematch
+
+import (
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"regexp"
+	"strings"
+)
+
+// Matcher finds the route pattern that matches an HTTP request.
+type Matcher struct {
+	routes []route
+}
+
+type route struct {
+	pattern string
+	method  string
+	regexp  *regexp.Regexp
+	// static is the number of static characters in the path, which is used to prefer more specific routes.
+	static int
+}
+
+// New creates a matcher for the given route patterns.
+//
+// A route pattern consists of an optional HTTP method and a path, such as "POST /v1/albums" or "/v1/albums/<id>".
+// Like in ozzo-routing, a path parameter "<name>" matches a single path segment, while "<name:pattern>" matches
+// the given regular expression. A pattern without a method matches requests of any method.
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, pattern := range patterns {
+		r, err := parse(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.routes = append(m.routes, r)
+	}
+	return m, nil
+}
+
+// NewForRouter creates a matcher for the routes registered with the given router, whose patterns consist of
+// the HTTP methods and the paths of the routes, such as "GET /v1/albums/<id>". It can be used to find the route
+// template of a request. The routes whose paths are not valid route patterns are ignored.
+func NewForRouter(router *routing.Router) *Matcher {
+	m := &Matcher{}
+	if router == nil {
+		return m
+	}
+	for _, route := range router.Routes() {
+		if r, err := parse(route.Method() + " " + route.Path()); err == nil {
+			m.routes = append(m.routes, r)
+		}
+	}
+	return m
+}
+
+// Path returns the path of the given route pattern without the HTTP method.
+func Path(pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	return strings.TrimSpace(pattern[strings.IndexByte(pattern, ' ')+1:])
+}
+
+// Match returns the route pattern that matches the given HTTP method and path.
+// If multiple patterns match, the one with the most static characters in its path is returned, and a pattern
+// with a method is preferred over one without. False is returned if no pattern matches.
+func (m *Matcher) Match(method, path string) (string, bool) {
+	var best *route
+	for i, r := range m.routes {
+		if r.method != "" && r.method != method || !r.regexp.MatchString(path) {
+			continue
+		}
+		if best == nil || r.static > best.static || r.static == best.static && r.method != "" && best.method == "" {
+			best = &m.routes[i]
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.pattern, true
+}
+
+// parse converts a route pattern into a route.
+func parse(pattern string) (route, error) {
+	r := route{pattern: pattern}
+	path := strings.TrimSpace(pattern)
+	if i := strings.IndexByte(path, ' '); i >= 0 {
+		r.method = strings.ToUpper(path[:i])
+		path = strings.TrimSpace(path[i+1:])
+	}
+	if !strings.HasPrefix(path, "/") {
+		return r, fmt.Errorf("route pattern %q: the path must start with a slash", pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for path != "" {
+		start := strings.IndexByte(path, '<')
+		if start < 0 {
+			start = len(path)
+		}
+		expr.WriteString(regexp.QuoteMeta(path[:start]))
+		r.static += start
+		if start == len(path) {
+			break
+		}
+		end := strings.IndexByte(path[start:], '>')
+		if end < 0 {
+			return r, fmt.Errorf("route pattern %q: unclosed path parameter", pattern)
+		}
+		param := path[start+1 : start+end]
+		if i := strings.IndexByte(param, ':'); i >= 0 {
+			expr.WriteString("(?:" + param[i+1:] + ")")
+		} else {
+			expr.WriteString("[^/]*")
+		}
+		path = path[start+end+1:]
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return r, fmt.Errorf("route pattern %q: %v", pattern, err)
+	}
+	r.regexp = re
+	return r, nil
+}
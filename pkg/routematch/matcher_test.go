@@ -0,0 +1,80 @@
+package routematch
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New("GET /v1/albums", "/v1/albums/<id>", "DELETE /v1/albums/<id:\\d+>")
+	assert.Nil(t, err)
+
+	for _, pattern := range []string{"", "GET", "GET v1/albums", "/v1/albums/<id", "/v1/albums/<id:(>"} {
+		_, err := New(pattern)
+		assert.NotNil(t, err, pattern)
+	}
+}
+
+func TestMatcher_Match(t *testing.T) {
+	m, err := New(
+		"GET /v1/albums",
+		"POST /v1/albums",
+		"/v1/albums/<id>",
+		"GET /v1/albums/<id>",
+		"GET /v1/albums/stream",
+		"DELETE /v1/users/<id:\\d+>",
+	)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tests := []struct {
+		method, path string
+		want         string
+		wantOK       bool
+	}{
+		{"GET", "/v1/albums", "GET /v1/albums", true},
+		{"POST", "/v1/albums", "POST /v1/albums", true},
+		{"PUT", "/v1/albums", "", false},
+		{"GET", "/v1/albums/123", "GET /v1/albums/<id>", true},
+		{"PUT", "/v1/albums/123", "/v1/albums/<id>", true},
+		{"GET", "/v1/albums/stream", "GET /v1/albums/stream", true},
+		{"GET", "/v1/albums/123/tracks", "", false},
+		{"DELETE", "/v1/users/123", "DELETE /v1/users/<id:\\d+>", true},
+		{"DELETE", "/v1/users/abc", "", false},
+		{"GET", "/v1/albumsx", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			got, ok := m.Match(tt.method, tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewForRouter(t *testing.T) {
+	router := routing.New()
+	router.Get("/healthcheck")
+	rg := router.Group("/v1")
+	rg.To("GET,HEAD", "/albums/<id>")
+	m := NewForRouter(router)
+
+	pattern, ok := m.Match("HEAD", "/v1/albums/1")
+	assert.True(t, ok)
+	assert.Equal(t, "HEAD /v1/albums/<id>", pattern)
+	pattern, ok = m.Match("GET", "/healthcheck")
+	assert.True(t, ok)
+	assert.Equal(t, "GET /healthcheck", pattern)
+	_, ok = m.Match("POST", "/healthcheck")
+	assert.False(t, ok)
+
+	_, ok = NewForRouter(nil).Match("GET", "/healthcheck")
+	assert.False(t, ok)
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/v1/albums/<id>", Path("GET /v1/albums/<id>"))
+	assert.Equal(t, "/v1/albums/<id>", Path("/v1/albums/<id>"))
+}
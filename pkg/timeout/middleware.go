@@ -0,0 +1,54 @@
+// Package timeout provides a middleware that limits the time spent on processing HTTP requests.
+package timeout
+
+import (
+	"context"
+	"fmt"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"time"
+)
+
+// Handler returns a middleware that sets a deadline on the context of every HTTP request.
+//
+// The given timeout applies to all requests unless routes contains a timeout for the route being requested.
+// The keys of routes are route patterns such as "GET /v1/albums/stream" (see routematch.New). A zero timeout
+// means no deadline. The deadline is enforced by the operations respecting the request context, such as DB queries.
+// If a request fails after its deadline is exceeded, the returned error wraps context.DeadlineExceeded.
+//
+// The middleware panics if routes contains an invalid route pattern.
+func Handler(timeout time.Duration, routes map[string]time.Duration) routing.Handler {
+	var patterns []string
+	for pattern := range routes {
+		patterns = append(patterns, pattern)
+	}
+	matcher, err := routematch.New(patterns...)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *routing.Context) error {
+		d := timeout
+		if pattern, ok := matcher.Match(c.Request.Method, c.Request.URL.Path); ok {
+			d = routes[pattern]
+		}
+		if d <= 0 {
+			return nil
+		}
+
+		req := c.Request
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer func() {
+			cancel()
+			// restore the request so that the middlewares before this one do not see the canceled context
+			c.Request = req
+		}()
+		c.Request = req.WithContext(ctx)
+
+		err := c.Next()
+		if err != nil && ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			return fmt.Errorf("%v: %w", err, context.DeadlineExceeded)
+		}
+		return err
+	}
+}
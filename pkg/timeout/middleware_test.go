@@ -0,0 +1,71 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler(time.Minute, map[string]time.Duration{
+		"GET /stream":  0,
+		"POST /albums": time.Millisecond,
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/albums", nil)
+		var deadline time.Time
+		var ok bool
+		c := routing.NewContext(httptest.NewRecorder(), req, h, func(c *routing.Context) error {
+			deadline, ok = c.Request.Context().Deadline()
+			return nil
+		})
+		assert.Nil(t, c.Next())
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+		assert.Equal(t, req, c.Request)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/stream", nil)
+		ok := true
+		c := routing.NewContext(httptest.NewRecorder(), req, h, func(c *routing.Context) error {
+			_, ok = c.Request.Context().Deadline()
+			return nil
+		})
+		assert.Nil(t, c.Next())
+		assert.False(t, ok)
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/albums", nil)
+		c := routing.NewContext(httptest.NewRecorder(), req, h, func(c *routing.Context) error {
+			<-c.Request.Context().Done()
+			return errors.New("query failed")
+		})
+		err := c.Next()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, "query failed: context deadline exceeded", err.Error())
+		assert.Nil(t, c.Request.Context().Err())
+	})
+
+	t.Run("error before deadline", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/albums", nil)
+		c := routing.NewContext(httptest.NewRecorder(), req, h, func(c *routing.Context) error {
+			return errors.New("failed")
+		})
+		err := c.Next()
+		assert.False(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestHandler_invalidRoute(t *testing.T) {
+	assert.Panics(t, func() {
+		Handler(time.Minute, map[string]time.Duration{"GET albums": 0})
+	})
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// RecordDB records a client span for a DB operation that has completed, such as a query whose duration is reported
+// by the ozzo-dbx log functions. The span is a child of the span in the given context, if any.
+// It is named after the SQL command (e.g. "SELECT") and carries the SQL statement.
+func RecordDB(ctx context.Context, tp trace.TracerProvider, d time.Duration, sql string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	operation := "SQL"
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+
+	end := time.Now()
+	_, span := tp.Tracer(instrumentationName).Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-d)),
+		trace.WithAttributes(semconv.DBStatementKey.String(sql), semconv.DBOperationKey.String(operation)),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+func TestRecordDB(t *testing.T) {
+	tp, exporter := NewForTest()
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	RecordDB(ctx, tp, 3*time.Millisecond, "select * from album", nil)
+	RecordDB(ctx, tp, time.Millisecond, "INSERT INTO album", errors.New("failed"))
+	RecordDB(nil, tp, time.Millisecond, "", nil)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 3) {
+		assert.Equal(t, "SELECT", spans[0].Name)
+		assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		assert.Equal(t, 3*time.Millisecond, spans[0].EndTime.Sub(spans[0].StartTime))
+		assert.Contains(t, spans[0].Attributes, semconv.DBStatementKey.String("select * from album"))
+
+		assert.Equal(t, "INSERT", spans[1].Name)
+		assert.Equal(t, codes.Error, spans[1].Status.Code)
+
+		assert.Equal(t, "SQL", spans[2].Name)
+		assert.False(t, spans[2].Parent.IsValid())
+	}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"github.com/qiangxue/go-rest-api/pkg/routematch"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sync"
+)
+
+// Handler returns a middleware that starts a server span for every HTTP request.
+//
+// The span joins the trace announced by the W3C traceparent header of the request, if any, and the trace context
+// is returned to the client in the traceparent response header. The span is named after the route template
+// (e.g. "GET /v1/albums/<id>") which is taken from the routes of the router when the first request is served.
+// The middleware should be installed before any other middleware so that their log messages carry the trace ID.
+func Handler(tp trace.TracerProvider) routing.Handler {
+	tracer := tp.Tracer(instrumentationName)
+	var (
+		once    sync.Once
+		matcher *routematch.Matcher
+	)
+	return func(c *routing.Context) error {
+		once.Do(func() {
+			matcher = routematch.NewForRouter(c.Router())
+		})
+
+		req := c.Request
+		name, route := "HTTP "+req.Method, ""
+		if pattern, ok := matcher.Match(req.Method, req.URL.Path); ok {
+			name, route = pattern, routematch.Path(pattern)
+		}
+
+		ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, req)...),
+		)
+		defer span.End()
+		c.Request = req.WithContext(ctx)
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Response.Header()))
+		rw := &access.LogResponseWriter{ResponseWriter: c.Response, Status: http.StatusOK}
+		c.Response = rw
+
+		err := c.Next()
+
+		status := rw.Status
+		if err != nil {
+			// the error has not been turned into a response yet; the router will respond the same way
+			span.RecordError(err)
+			status = http.StatusInternalServerError
+			if httpError, ok := err.(routing.HTTPError); ok {
+				status = httpError.StatusCode()
+			}
+		}
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+
+		return err
+	}
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"errors"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tp, exporter := NewForTest()
+	router := routing.New()
+	router.Use(Handler(tp))
+	var sc trace.SpanContext
+	router.Get("/v1/albums/<id>", func(c *routing.Context) error {
+		sc = trace.SpanContextFromContext(c.Request.Context())
+		return c.Write("ok")
+	})
+	router.Post("/v1/albums", func(c *routing.Context) error {
+		return errors.New("failed")
+	})
+
+	t.Run("new trace", func(t *testing.T) {
+		exporter.Reset()
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/albums/1", nil)
+		router.ServeHTTP(res, req)
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			span := spans[0]
+			assert.Equal(t, "GET /v1/albums/<id>", span.Name)
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+			assert.False(t, span.Parent.IsValid())
+			assert.Equal(t, sc, span.SpanContext)
+			assert.Contains(t, span.Attributes, semconv.HTTPRouteKey.String("/v1/albums/<id>"))
+			assert.Contains(t, span.Attributes, semconv.HTTPStatusCodeKey.Int(http.StatusOK))
+		}
+		assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", res.Header().Get("traceparent"))
+	})
+
+	t.Run("propagated trace", func(t *testing.T) {
+		exporter.Reset()
+		req, _ := http.NewRequest("GET", "/v1/albums/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+			assert.True(t, spans[0].Parent.IsRemote())
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		exporter.Reset()
+		req, _ := http.NewRequest("POST", "/v1/albums", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "POST /v1/albums", spans[0].Name)
+			assert.Equal(t, codes.Error, spans[0].Status.Code)
+			assert.Contains(t, spans[0].Attributes, semconv.HTTPStatusCodeKey.Int(http.StatusInternalServerError))
+			assert.Len(t, spans[0].Events, 1)
+		}
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		exporter.Reset()
+		req, _ := http.NewRequest("GET", "/unknown", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "HTTP GET", spans[0].Name)
+			assert.Contains(t, spans[0].Attributes, semconv.HTTPStatusCodeKey.Int(http.StatusNotFound))
+		}
+	})
+}
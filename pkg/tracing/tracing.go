@@ -0,0 +1,87 @@
+// Package tracing provides distributed tracing of HTTP requests and DB operations based on OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"net/http"
+)
+
+// instrumentationName is the name of the tracer creating the spans of this package.
+const instrumentationName = "github.com/qiangxue/go-rest-api/pkg/tracing"
+
+// propagator propagates the trace context via the W3C traceparent and tracestate headers.
+var propagator = propagation.TraceContext{}
+
+// New creates a tracer provider which exports the spans using the named exporter.
+//
+// The exporter can be "otlp", "stdout" or "off". The OTLP exporter sends the spans over HTTP and is configured by
+// the standard OTEL_EXPORTER_OTLP_* environment variables (e.g. OTEL_EXPORTER_OTLP_ENDPOINT). When the exporter
+// is "off", spans are not recorded, but the trace context is still propagated and can be found in the log messages.
+// The returned provider should be shut down to flush the pending spans before the application exits.
+func New(exporter, serviceName, version string) (*sdktrace.TracerProvider, error) {
+	ctx := context.Background()
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName), semconv.ServiceVersionKey.String(version)),
+		// allow overriding the service attributes via OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var e sdktrace.SpanExporter
+	switch exporter {
+	case "otlp":
+		e, err = otlptracehttp.New(ctx)
+	case "stdout":
+		e, err = stdouttrace.New()
+	case "off", "":
+		// no span is sampled; the exporter is only needed so that the provider can be shut down
+		return sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.NeverSample()),
+			sdktrace.WithSyncer(discardExporter{}),
+		), nil
+	default:
+		err = fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithResource(res), sdktrace.WithBatcher(e)), nil
+}
+
+// discardExporter is a span exporter which drops the spans.
+type discardExporter struct{}
+
+// ExportSpans drops the given spans.
+func (discardExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+// Shutdown does nothing as the exporter holds no resources.
+func (discardExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// NewForTest returns a new tracer provider and the in-memory exporter which can be used in unit tests to verify spans.
+// The spans are exported as soon as they end.
+func NewForTest() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+// Inject adds the trace context in the given context to the headers of an outgoing HTTP request,
+// so that the services called while processing a request can join its trace.
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	for _, exporter := range []string{"otlp", "stdout", "off"} {
+		tp, err := New(exporter, "test", "1.0.0")
+		if assert.Nil(t, err, exporter) {
+			assert.Nil(t, tp.Shutdown(context.Background()))
+		}
+	}
+	_, err := New("unknown", "test", "1.0.0")
+	assert.NotNil(t, err)
+}
+
+func TestNew_off(t *testing.T) {
+	tp, _ := New("off", "test", "1.0.0")
+	_, span := tp.Tracer("test").Start(context.Background(), "test")
+	assert.False(t, span.IsRecording())
+	assert.True(t, span.SpanContext().IsValid())
+}
+
+func TestNewForTest(t *testing.T) {
+	tp, exporter := NewForTest()
+	_, span := tp.Tracer("test").Start(context.Background(), "test")
+	span.End()
+	if assert.Len(t, exporter.GetSpans(), 1) {
+		assert.Equal(t, "test", exporter.GetSpans()[0].Name)
+	}
+}
+
+func TestInject(t *testing.T) {
+	tp, _ := NewForTest()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	header := http.Header{}
+	Inject(ctx, header)
+	assert.Equal(t, "00-"+span.SpanContext().TraceID().String()+"-"+span.SpanContext().SpanID().String()+"-01", header.Get("traceparent"))
+
+	header = http.Header{}
+	Inject(trace.ContextWithSpanContext(context.Background(), trace.SpanContext{}), header)
+	assert.Empty(t, header.Get("traceparent"))
+}
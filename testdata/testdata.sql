@@ -1,6 +0,0 @@
-INSERT INTO album (id, name, created_at, updated_at)
-VALUES ('967d5bb5-3a7a-4d5e-8a6c-febc8c5b3f13', 'Hollywood''s Bleeding', '2019-10-01 15:36:38'::timestamp, '2019-10-01 15:36:38'::timestamp),
-       ('c809bf15-bc2c-4621-bb96-70af96fd5d67', 'AI YoungBoy 2', '2019-10-02 11:16:12'::timestamp, '2019-10-02 11:16:12'::timestamp),
-       ('2367710a-d4fb-49f5-8860-557b337386dd', 'KIRK', '2019-10-05 05:21:11'::timestamp, '2019-10-05 05:21:11'::timestamp),
-       ('b0a24f12-428f-4ff5-84d5-bc1fdcff6f03', 'Lover', '2019-10-11 19:43:18'::timestamp, '2019-10-11 19:43:18'::timestamp),
-       ('e0bb80ec-75a6-4348-bfc3-6ac1e89b195e', 'So Much Fun', '2019-10-12 12:16:02'::timestamp, '2019-10-12 12:16:02'::timestamp);